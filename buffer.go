@@ -0,0 +1,28 @@
+package mrpc
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBufferSize limits the capacity of buffers which are returned to
+// the pool, so that a single large message does not pin its memory.
+const maxPooledBufferSize = 64 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns buf to the pool. The buffer's content must not be
+// referenced after calling putBuffer.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
@@ -0,0 +1,120 @@
+package mrpc
+
+import (
+	"context"
+	"time"
+)
+
+// ServiceBuilder builds a service specification with a fluent interface,
+// e.g.
+//
+//	spec := mrpc.NewService("invoices", svc).
+//		Method(1, getInvoice).Timeout(time.Second).
+//		Method(2, createInvoice).Validate(validateInvoice).
+//		Build()
+//
+// The methods Version, Aliases, Deprecated, Use, Timeout and Validate
+// configure the method which was added last. Calling them before a method
+// was added panics.
+type ServiceBuilder struct {
+	spec ServiceSpec
+}
+
+// NewService returns a builder for a service with the given name and
+// implementation.
+func NewService(name string, svc interface{}) *ServiceBuilder {
+	return &ServiceBuilder{spec: ServiceSpec{Name: name, Service: svc}}
+}
+
+// Method adds a method with the given id and handler.
+func (b *ServiceBuilder) Method(id int, h Handler) *ServiceBuilder {
+	b.spec.Methods = append(b.spec.Methods, MethodSpec{ID: id, Handler: h})
+	return b
+}
+
+// Version sets the version of the last method (see MethodSpec).
+func (b *ServiceBuilder) Version(version int) *ServiceBuilder {
+	b.last().Version = version
+	return b
+}
+
+// Aliases adds aliases for the last method (see MethodSpec).
+func (b *ServiceBuilder) Aliases(ids ...int) *ServiceBuilder {
+	m := b.last()
+	m.Aliases = append(m.Aliases, ids...)
+	return b
+}
+
+// Deprecated marks the last method as deprecated with the given message.
+// If the message is empty, a default message is used (see MethodSpec).
+func (b *ServiceBuilder) Deprecated(msg string) *ServiceBuilder {
+	m := b.last()
+	m.Deprecated = true
+	m.DeprecationMessage = msg
+	return b
+}
+
+// Use wraps the handler of the last method with the given middlewares.
+// The middlewares are executed in the order they are provided, after all
+// server interceptors. If the handler of the last method is nil, the
+// function will panic.
+func (b *ServiceBuilder) Use(middlewares ...Middleware) *ServiceBuilder {
+	m := b.last()
+	if m.Handler == nil {
+		panic("nil handler for method " + methodKey{service: b.spec.Name, id: m.ID}.String())
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		m.Handler = middlewares[i](m.Handler)
+	}
+	return b
+}
+
+// Timeout limits the execution time of the last method's handler to d, in
+// addition to the deadline of the call.
+func (b *ServiceBuilder) Timeout(d time.Duration) *ServiceBuilder {
+	return b.Use(func(h Handler) Handler {
+		return func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return h(ctx, svc, body)
+		}
+	})
+}
+
+// Validate validates the request body of the last method with validate
+// before the handler is called. If the validation fails, the handler is
+// not called and the validation error is returned. Errors without an
+// error code are reported with the InvalidArgument code.
+func (b *ServiceBuilder) Validate(validate func(body []byte) error) *ServiceBuilder {
+	return b.Use(func(h Handler) Handler {
+		return func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+			if err := validate(body); err != nil {
+				if ErrorCode(err) == Unknown {
+					err = Error(InvalidArgument, err.Error())
+				}
+				return nil, err
+			}
+			return h(ctx, svc, body)
+		}
+	})
+}
+
+// Build returns the service specification. If the specification cannot be
+// registered, e.g. because multiple methods with the same id and version
+// were added (see Server.TryRegister), the function will panic.
+func (b *ServiceBuilder) Build() ServiceSpec {
+	if err := validateServiceSpec(b.spec); err != nil {
+		panic(err.Error())
+	}
+
+	spec := b.spec
+	spec.Methods = append([]MethodSpec(nil), b.spec.Methods...)
+	return spec
+}
+
+func (b *ServiceBuilder) last() *MethodSpec {
+	if len(b.spec.Methods) == 0 {
+		panic("no method to configure in service " + b.spec.Name)
+	}
+	return &b.spec.Methods[len(b.spec.Methods)-1]
+}
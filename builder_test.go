@@ -0,0 +1,125 @@
+package mrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestServiceBuilder(t *testing.T) {
+	ctx := context.Background()
+
+	echo := func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		return body, nil
+	}
+	deadline := func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		d, ok := ctx.Deadline()
+		if !ok || time.Until(d) > time.Second {
+			return nil, errors.New("missing deadline")
+		}
+		return nil, nil
+	}
+	suffix := func(s string) Middleware {
+		return func(h Handler) Handler {
+			return func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+				return h(ctx, svc, append(body, s...))
+			}
+		}
+	}
+
+	notEmpty := func(body []byte) error {
+		if len(body) == 0 {
+			return errors.New("empty body")
+		}
+		return nil
+	}
+
+	s := newServer(t)
+	s.Register(NewService("my-service", struct{}{}).
+		Method(1, echo).Aliases(11).Use(suffix("-a"), suffix("-b")).
+		Method(2, deadline).Timeout(time.Second).
+		Method(3, echo).Validate(notEmpty).
+		Method(4, echo).Version(2).Deprecated("").
+		Build())
+
+	tests := []struct {
+		method int
+		body   string
+		code   ErrCode
+		result string
+	}{
+		{method: 1, body: "body", result: "body-a-b"},
+		{method: 11, body: "body", result: "body-a-b"},
+		{method: 2},
+		{method: 3, body: "body", result: "body"},
+		{method: 3, code: InvalidArgument},
+		{method: 4, body: "body", result: "body"},
+	}
+
+	for _, test := range tests {
+		resp := s.Execute(ctx, Request{Service: "my-service", Method: test.method, Body: []byte(test.body)})
+		if resp.ErrorCode != test.code {
+			t.Fatalf("unexpected error code for method %d: %v (%s)", test.method, resp.ErrorCode, resp.ErrorText)
+		} else if string(resp.Body) != test.result {
+			t.Fatalf("unexpected result for method %d: %q", test.method, resp.Body)
+		}
+	}
+
+	resp := s.Execute(ctx, Request{Service: "my-service", Method: 4, Headers: RequestHeaders{MethodVersion: 2}})
+	if resp.Metadata[DeprecatedKey] == "" {
+		t.Fatal("missing deprecation warning")
+	}
+}
+
+func TestServiceBuilderPanics(t *testing.T) {
+	handler := func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		return nil, nil
+	}
+
+	tests := []struct {
+		name  string
+		build func()
+		msg   string
+	}{
+		{
+			name:  "duplicate",
+			build: func() { NewService("my-service", struct{}{}).Method(1, handler).Method(1, handler).Build() },
+			msg:   "duplicate method id 1 in service my-service",
+		},
+		{
+			name:  "nil-handler",
+			build: func() { NewService("my-service", struct{}{}).Method(1, nil).Build() },
+			msg:   "nil handler for method my-service:1",
+		},
+		{
+			name:  "nil-handler-middleware",
+			build: func() { NewService("my-service", struct{}{}).Method(1, nil).Timeout(time.Second) },
+			msg:   "nil handler for method my-service:1",
+		},
+		{
+			name:  "alias-in-use",
+			build: func() { NewService("my-service", struct{}{}).Method(1, handler).Method(2, handler).Aliases(1).Build() },
+			msg:   "alias 1 of method my-service:2 already in use",
+		},
+		{
+			name:  "no-method",
+			build: func() { NewService("my-service", struct{}{}).Version(1) },
+			msg:   "no method to configure in service my-service",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if msg := recover(); msg != test.msg {
+					t.Fatalf("unexpected panic message: %v", msg)
+				}
+			}()
+			test.build()
+		})
+	}
+
+	// Different versions of a method share an id.
+	NewService("my-service", struct{}{}).Method(1, handler).Version(1).Method(1, handler).Version(2).Build()
+}
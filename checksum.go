@@ -0,0 +1,47 @@
+package mrpc
+
+import (
+	"context"
+	"hash/crc32"
+)
+
+// CRC32 computes the IEEE CRC-32 checksum of p. It is the default checksum
+// function of the checksum interceptors.
+func CRC32(p []byte) uint64 {
+	return uint64(crc32.ChecksumIEEE(p))
+}
+
+// ChecksumInterceptor returns a client interceptor which sets the Checksum
+// header of each request to the checksum of the request body. If sum is
+// nil, CRC32 is used.
+func ChecksumInterceptor(sum func([]byte) uint64) ClientInterceptor {
+	if sum == nil {
+		sum = CRC32
+	}
+
+	return func(ctx context.Context, req Request, c Caller) (Response, error) {
+		req.Headers.Checksum = sum(req.Body)
+		return c.Call(ctx, req)
+	}
+}
+
+// VerifyChecksumInterceptor returns a server interceptor which verifies the
+// Checksum header of each request against the request body. Requests with
+// a mismatching checksum are rejected with a DataLoss error. Requests
+// without a checksum (i.e. a zero Checksum header) are not verified. The
+// sum function has to match the one of the clients. If sum is nil, CRC32
+// is used.
+func VerifyChecksumInterceptor(sum func([]byte) uint64) ServerInterceptor {
+	if sum == nil {
+		sum = CRC32
+	}
+
+	return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		if expected := call.Headers.Checksum; expected != 0 {
+			if actual := sum(call.Body); actual != expected {
+				return nil, Errorf(DataLoss, "checksum mismatch (%x != %x)", actual, expected)
+			}
+		}
+		return h(ctx, call.Service, call.Body)
+	}
+}
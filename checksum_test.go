@@ -0,0 +1,47 @@
+package mrpc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestChecksum(t *testing.T) {
+	ctx := context.Background()
+
+	s := newServer(t, WithServerInterceptor(VerifyChecksumInterceptor(nil)))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return body, nil
+				},
+			},
+		},
+	})
+
+	var req Request
+	conn := newClientConn(func(r Request) Response {
+		req = r
+		return Response{}
+	})
+	client := NewClient(conn, WithClientInterceptor(ChecksumInterceptor(nil)))
+	if _, err := client.Call(ctx, Request{Service: "my-service", Method: 1, Body: []byte("request body")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if req.Headers.Checksum == 0 {
+		t.Fatal("missing checksum")
+	}
+
+	resp := s.Execute(ctx, req)
+	if err := ResponseError(resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req.Body[0] ^= 0x01
+	resp = s.Execute(ctx, req)
+	if resp.ErrorCode != DataLoss {
+		t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+	}
+}
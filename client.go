@@ -2,7 +2,10 @@ package mrpc
 
 import (
 	"context"
+	"errors"
 	"io"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/mprot/msgpack-go"
@@ -13,34 +16,145 @@ type Caller interface {
 	Call(ctx context.Context, req Request) (Response, error)
 }
 
+// CallerFunc is an adapter to allow the use of ordinary functions as
+// callers.
+type CallerFunc func(ctx context.Context, req Request) (Response, error)
+
+// Call implements the Caller interface by calling f.
+func (f CallerFunc) Call(ctx context.Context, req Request) (Response, error) {
+	return f(ctx, req)
+}
+
 // Client is mrpc client to call service methods. A client is transport
-// independent.
+// independent. It is safe for concurrent use, where concurrent calls are
+// serialized on the underlying reader and writer.
 type Client struct {
-	rw io.ReadWriter
+	mtx        sync.Mutex // serializes the write and read of a call
+	rw         io.ReadWriter
+	intercept  ClientInterceptor
+	minTimeout time.Duration
+	validate   func(Response) error
+	requestID  func() string
+	noTimeout  bool // see WithoutClientTimeout
+	clock      clock
+	broken     bool // the connection is out of sync after a read timeout
 }
 
-// NewClient creates a new mrpc client. When calling a method with Call, the
-// request will be written to the writing part and the response will be read
-// from the reading part of rw.
-func NewClient(rw io.ReadWriter) *Client {
-	return &Client{rw: rw}
+// NewClient creates a new mrpc client with the given options. When calling
+// a method with Call, the request will be written to the writing part and
+// the response will be read from the reading part of rw. If an invalid
+// option is passed, the function will panic.
+func NewClient(rw io.ReadWriter, o ...ClientOption) *Client {
+	opts := defaultClientOptions()
+	if err := opts.apply(o); err != nil {
+		panic(err.Error())
+	}
+
+	return &Client{
+		rw:         rw,
+		intercept:  clientInterceptorChain(opts.interceptors),
+		minTimeout: opts.minTimeout,
+		validate:   opts.validate,
+		requestID:  opts.requestID,
+		noTimeout:  opts.noTimeout,
+		clock:      opts.clock,
+	}
 }
 
 // Call calls a remote method by writing the request to the client's writer
-// and reading the response from the client's reader.
+// and reading the response from the client's reader. All configured client
+// interceptors are executed before the request is written. If a request id
+// generator is set (see WithRequestIDGenerator) and the request has no id,
+// a new id is generated.
 func (c *Client) Call(ctx context.Context, req Request) (Response, error) {
+	if c.requestID != nil && req.Headers.RequestID == "" {
+		req.Headers.RequestID = c.requestID()
+	}
+	return c.intercept(ctx, req, CallerFunc(c.call))
+}
+
+func (c *Client) call(ctx context.Context, req Request) (Response, error) {
+	if req.Headers.Version == 0 {
+		req.Headers.Version = ProtocolVersion
+	}
+	var readDeadline time.Time
 	if deadline, ok := ctx.Deadline(); ok {
-		timeout := time.Until(deadline)
-		if timeout > 0 && (req.Headers.Timeout == 0 || uint64(timeout) < req.Headers.Timeout) {
+		timeout := c.clock.Until(deadline)
+		if c.minTimeout > 0 && timeout < c.minTimeout {
+			return Response{}, Errorf(Timeout, "remaining timeout %v is below the minimum of %v", timeout, c.minTimeout)
+		}
+		switch {
+		case c.noTimeout:
+			readDeadline = deadline
+		case timeout > 0 && (req.Headers.Timeout == 0 || uint64(timeout) < req.Headers.Timeout):
 			req.Headers.Timeout = uint64(timeout)
 		}
 	}
 
-	if err := msgpack.Encode(c.rw, &req); err != nil {
+	// The request is encoded completely before it is written with a single
+	// write, so that a failed encoding never leaves a partial request on the
+	// connection.
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if err := msgpack.Encode(buf, &req); err != nil {
 		return Response{}, err
 	}
 
 	var resp Response
-	err := msgpack.Decode(c.rw, &resp)
-	return resp, err
+	if err := c.roundTrip(buf.Bytes(), &resp, readDeadline); err != nil {
+		return resp, err
+	}
+
+	if c.validate != nil {
+		if err := c.validate(resp); err != nil {
+			if ErrorCode(err) == Unknown {
+				err = Errorf(Internal, "invalid response: %s", err.Error())
+			}
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// errBrokenConn is returned for calls of a client whose connection is out of
+// sync. It has no error code, so that it is treated as a transport error.
+var errBrokenConn = errors.New("connection unusable after a read timeout")
+
+// roundTrip writes the encoded request and reads the response. If deadline
+// is not zero and the client's reader supports read deadlines, reading the
+// response is bounded by deadline. If reading the response times out, the
+// late response would be read as the response of the next call, so the
+// client is marked as broken and rejects all further calls.
+func (c *Client) roundTrip(req []byte, resp *Response, deadline time.Time) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.broken {
+		return errBrokenConn
+	}
+	if _, err := c.rw.Write(req); err != nil {
+		return err
+	}
+
+	if d, ok := c.rw.(interface{ SetReadDeadline(time.Time) error }); ok && !deadline.IsZero() {
+		if err := d.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+		defer d.SetReadDeadline(time.Time{})
+	}
+
+	err := msgpack.Decode(c.rw, resp)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		c.broken = true
+		return Errorf(Timeout, "read response: %s", err.Error())
+	}
+	return err
+}
+
+// isBroken reports whether the client rejects all calls because its
+// connection is out of sync.
+func (c *Client) isBroken() bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.broken
 }
@@ -3,7 +3,11 @@ package mrpc
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,7 +18,7 @@ func TestClientCall(t *testing.T) {
 	request := Request{
 		Service: "service",
 		Method:  3,
-		Headers: RequestHeaders{},
+		Headers: RequestHeaders{Version: ProtocolVersion},
 		Body:    []byte("request body"),
 	}
 
@@ -22,6 +26,7 @@ func TestClientCall(t *testing.T) {
 		ErrorCode: OK,
 		ErrorText: "error",
 		Body:      []byte("response body"),
+		Metadata:  map[string]string{"key": "value"},
 	}
 
 	t.Run("no-timeout", func(t *testing.T) {
@@ -139,34 +144,360 @@ func TestClientCall(t *testing.T) {
 	})
 }
 
+func TestClientCallTimeout(t *testing.T) {
+	clock := fakeClock{now: time.Now()}
+
+	tests := []struct {
+		remaining time.Duration
+		header    time.Duration
+		expected  time.Duration
+	}{
+		{remaining: time.Second, header: 0, expected: time.Second},
+		{remaining: time.Second, header: time.Minute, expected: time.Second},
+		{remaining: time.Minute, header: time.Second, expected: time.Second},
+		{remaining: time.Microsecond, header: 0, expected: time.Microsecond},
+		{remaining: 0, header: 0, expected: 0},
+		{remaining: -time.Second, header: time.Second, expected: time.Second},
+	}
+
+	for _, test := range tests {
+		var timeout time.Duration
+		conn := newClientConn(func(req Request) Response {
+			timeout = time.Duration(req.Headers.Timeout)
+			return Response{}
+		})
+		client := NewClient(conn, withClientClock(clock))
+
+		ctx, cancel := context.WithDeadline(context.Background(), clock.now.Add(test.remaining))
+		_, err := client.Call(ctx, Request{Headers: RequestHeaders{Timeout: uint64(test.header)}})
+		cancel()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if timeout != test.expected {
+			t.Fatalf("unexpected timeout for remaining %v and header %v: %v", test.remaining, test.header, timeout)
+		}
+	}
+}
+
+func TestClientMinTimeout(t *testing.T) {
+	sent := false
+	conn := newClientConn(func(req Request) Response {
+		sent = true
+		return Response{}
+	})
+	client := NewClient(conn, WithMinTimeout(time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	_, err := client.Call(ctx, Request{})
+	switch {
+	case ErrorCode(err) != Timeout:
+		t.Fatalf("unexpected error: %v", err)
+	case sent:
+		t.Fatal("unexpected request")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if _, err = client.Call(ctx, Request{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !sent {
+		t.Fatal("request not sent")
+	}
+}
+
+func TestClientWithoutClientTimeout(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	t.Run("header", func(t *testing.T) {
+		var timeout uint64
+		conn := &deadlineConn{clientConn: newClientConn(func(req Request) Response {
+			timeout = req.Headers.Timeout
+			return Response{}
+		})}
+		client := NewClient(conn, WithoutClientTimeout())
+
+		if _, err := client.Call(ctx, Request{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		switch {
+		case timeout != 0:
+			t.Fatalf("unexpected timeout header: %v", time.Duration(timeout))
+		case len(conn.deadlines) != 2 || !conn.deadlines[0].Equal(deadline) || !conn.deadlines[1].IsZero():
+			t.Fatalf("unexpected read deadlines: %v", conn.deadlines)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		conn := &deadlineConn{clientConn: newClientConn(nil), expired: true}
+		client := NewClient(conn, WithoutClientTimeout())
+
+		if _, err := client.Call(ctx, Request{}); ErrorCode(err) != Timeout {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// The late response of the first call must not be read as the
+		// response of the second call.
+		conn.expired = false
+		written := len(conn.req)
+		if _, err := client.Call(ctx, Request{}); err != errBrokenConn {
+			t.Fatalf("unexpected error for call after timeout: %v", err)
+		} else if len(conn.req) != written {
+			t.Fatal("request written to broken connection")
+		}
+	})
+}
+
+// deadlineConn records the read deadlines set by the client. If expired
+// is set, all reads fail with a deadline error.
+type deadlineConn struct {
+	*clientConn
+	deadlines []time.Time
+	expired   bool
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	c.deadlines = append(c.deadlines, t)
+	return nil
+}
+
+func (c *deadlineConn) Read(p []byte) (int, error) {
+	if c.expired {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return c.clientConn.Read(p)
+}
+
+func TestClientResponseValidator(t *testing.T) {
+	ctx := context.Background()
+
+	validator := WithResponseValidator(func(resp Response) error {
+		if string(resp.Body) != "valid" {
+			return errors.New("unexpected body")
+		}
+		return nil
+	})
+
+	conn := newClientConn(func(req Request) Response {
+		return Response{Body: []byte("valid")}
+	})
+	if _, err := NewClient(conn, validator).Call(ctx, Request{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	conn = newClientConn(func(req Request) Response {
+		return Response{Body: []byte("invalid")}
+	})
+	_, err := NewClient(conn, validator).Call(ctx, Request{})
+	switch {
+	case err == nil:
+		t.Fatal("expected error, got none")
+	case ErrorCode(err) != Internal:
+		t.Fatalf("unexpected error code: %v", ErrorCode(err))
+	case err.Error() != "invalid response: unexpected body":
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestClientInterceptors(t *testing.T) {
+	ctx := context.Background()
+
+	var order []string
+	interceptor := func(name string) ClientInterceptor {
+		return func(ctx context.Context, req Request, c Caller) (Response, error) {
+			order = append(order, name)
+			req.Body = append(req.Body, name...)
+			return c.Call(ctx, req)
+		}
+	}
+
+	conn := newClientConn(func(req Request) Response {
+		return Response{Body: req.Body}
+	})
+	client := NewClient(conn,
+		WithClientInterceptor(interceptor("a")),
+		WithClientInterceptor(interceptor("b")),
+		WithClientInterceptor(interceptor("c")),
+	)
+
+	resp, err := client.Call(ctx, Request{})
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case string(resp.Body) != "abc":
+		t.Fatalf("unexpected response body: %q", resp.Body)
+	case !reflect.DeepEqual(order, []string{"a", "b", "c"}):
+		t.Fatalf("unexpected interceptor order: %v", order)
+	}
+}
+
+func TestClientRequestIDGenerator(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t)
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	tests := []struct {
+		id       string
+		expected string
+		calls    int
+	}{
+		{id: "", expected: "generated", calls: 1},
+		{id: "explicit", expected: "explicit", calls: 0},
+	}
+
+	for _, test := range tests {
+		calls := 0
+		conn := newClientConn(func(req Request) Response {
+			return s.Execute(ctx, req)
+		})
+		client := NewClient(conn, WithRequestIDGenerator(func() string {
+			calls++
+			return "generated"
+		}))
+
+		req := Request{Service: "my-service", Method: 1, Headers: RequestHeaders{RequestID: test.id}}
+		resp, err := client.Call(ctx, req)
+		switch {
+		case err != nil:
+			t.Fatalf("unexpected error: %v", err)
+		case resp.RequestID != test.expected:
+			t.Fatalf("unexpected request id for %q: %q", test.id, resp.RequestID)
+		case calls != test.calls:
+			t.Fatalf("unexpected generator calls for %q: %d", test.id, calls)
+		}
+	}
+}
+
+func TestClientConcurrentCalls(t *testing.T) {
+	ctx := context.Background()
+
+	conn := &echoConn{t: t}
+	client := NewClient(conn)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				body := []byte(fmt.Sprintf("request %d/%d", i, j))
+				resp, err := client.Call(ctx, Request{Service: "echo", Body: body})
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				} else if !bytes.Equal(resp.Body, body) {
+					t.Errorf("unexpected response body: %q (expected %q)", resp.Body, body)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// echoConn expects each write to contain exactly one complete request and
+// answers it with a response containing the request body.
+type echoConn struct {
+	t    *testing.T
+	mtx  sync.Mutex
+	resp bytes.Buffer
+}
+
+func (c *echoConn) Read(p []byte) (int, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.resp.Read(p)
+}
+
+func (c *echoConn) Write(p []byte) (int, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var req Request
+	r := bytes.NewReader(p)
+	if err := msgpack.Decode(r, &req); err != nil {
+		c.t.Errorf("incomplete request written: %v", err)
+		return 0, err
+	} else if r.Len() != 0 {
+		c.t.Errorf("unexpected trailing data of %d bytes", r.Len())
+	}
+
+	if err := msgpack.Encode(&c.resp, &Response{Body: req.Body}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// clientConn answers the requests written to it with serve, which maps an
+// encoded request to an encoded response. A request is answered when the
+// first part of its response is read, so each request has to be written
+// completely before reading the response.
 type clientConn struct {
-	f    func(Request) Response
-	req  []byte
-	resp []byte
-	pos  int
+	serve func(req []byte) ([]byte, error)
+	req   []byte
+	resp  []byte
+	pos   int
 }
 
+// newClientConn returns a connection which answers each request with f.
 func newClientConn(f func(Request) Response) *clientConn {
-	return &clientConn{f: f, pos: -1}
+	return &clientConn{
+		serve: func(p []byte) ([]byte, error) {
+			var req Request
+			if err := msgpack.Decode(bytes.NewReader(p), &req); err != nil {
+				return nil, err
+			}
+			resp := f(req)
+
+			var buf bytes.Buffer
+			err := msgpack.Encode(&buf, &resp)
+			return buf.Bytes(), err
+		},
+		pos: -1,
+	}
+}
+
+// newServerConn returns a connection which serves each request with
+// s.ServeMRPC, including the server's wire decoding and encoding.
+func newServerConn(s *Server) *clientConn {
+	return &clientConn{
+		serve: func(p []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			err := s.ServeMRPC(context.Background(), bytes.NewReader(p), &buf)
+			return buf.Bytes(), err
+		},
+		pos: -1,
+	}
 }
 
 func (c *clientConn) Read(p []byte) (int, error) {
 	if c.pos < 0 {
-		var req Request
-		err := msgpack.Decode(bytes.NewReader(c.req), &req)
+		resp, err := c.serve(c.req)
 		if err != nil {
 			return 0, err
 		}
-		resp := c.f(req)
-
-		var buf bytes.Buffer
-		if err := msgpack.Encode(&buf, &resp); err != nil {
-			return 0, err
-		}
-		c.resp = buf.Bytes()
+		c.req, c.resp, c.pos = c.req[:0], resp, 0
 	}
-	n := copy(p, c.resp)
+	n := copy(p, c.resp[c.pos:])
 	c.pos += n
+	if c.pos == len(c.resp) {
+		c.pos = -1 // answer the next request on the next read
+	}
 	return n, nil
 }
 
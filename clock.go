@@ -0,0 +1,28 @@
+package mrpc
+
+import (
+	"context"
+	"time"
+)
+
+// clock provides the time functions used for the timeout handling of
+// clients and servers. It allows tests to control the current time.
+type clock interface {
+	Now() time.Time
+	Until(t time.Time) time.Duration
+	WithDeadline(ctx context.Context, d time.Time) (context.Context, context.CancelFunc)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Until(t time.Time) time.Duration {
+	return time.Until(t)
+}
+
+func (realClock) WithDeadline(ctx context.Context, d time.Time) (context.Context, context.CancelFunc) {
+	return context.WithDeadline(ctx, d)
+}
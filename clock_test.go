@@ -0,0 +1,79 @@
+package mrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestRelativeTimeout ensures that deadlines are transmitted as relative
+// timeouts, which the server applies to its own clock. Therefore skewed
+// clocks of the client and the server do not affect the deadline.
+func TestRelativeTimeout(t *testing.T) {
+	clientClock := fakeClock{now: time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)}
+	serverClock := fakeClock{now: clientClock.now.Add(-time.Hour)}
+
+	var deadline time.Time
+	s := newServer(t, withServerClock(serverClock))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					deadline, _ = ctx.Deadline()
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	var timeout uint64
+	conn := newClientConn(func(req Request) Response {
+		timeout = req.Headers.Timeout
+		return s.Execute(context.Background(), req)
+	})
+	client := NewClient(conn, withClientClock(clientClock))
+
+	ctx, cancel := context.WithDeadline(context.Background(), clientClock.now.Add(5*time.Second))
+	defer cancel()
+	if _, err := client.Call(ctx, Request{Service: "my-service", Method: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	switch {
+	case time.Duration(timeout) != 5*time.Second:
+		t.Fatalf("unexpected timeout header: %v", time.Duration(timeout))
+	case !deadline.Equal(serverClock.now.Add(5 * time.Second)):
+		t.Fatalf("unexpected server deadline: %v", deadline)
+	}
+}
+
+// fakeClock is a clock which is fixed at a given point in time.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c fakeClock) Until(t time.Time) time.Duration {
+	return t.Sub(c.now)
+}
+
+func (c fakeClock) WithDeadline(ctx context.Context, d time.Time) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	return deadlineContext{Context: ctx, deadline: d}, cancel
+}
+
+// deadlineContext reports a deadline without ever expiring on its own.
+type deadlineContext struct {
+	context.Context
+	deadline time.Time
+}
+
+func (c deadlineContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
@@ -0,0 +1,135 @@
+package mrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/mprot/msgpack-go"
+)
+
+// Well-known body encodings (see RequestHeaders.BodyEncoding).
+const (
+	// MsgpackEncoding denotes msgpack encoded bodies. It is the default
+	// encoding of requests without a body encoding. Values have to implement
+	// the msgpack Encoder or Decoder interface.
+	MsgpackEncoding = "msgpack"
+
+	// JSONEncoding denotes JSON encoded bodies.
+	JSONEncoding = "json"
+)
+
+// BodyCodec defines an interface for encoding and decoding request and
+// response bodies.
+type BodyCodec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(body []byte, v interface{}) error
+}
+
+var bodyCodecs = struct {
+	sync.RWMutex
+	codecs map[string]BodyCodec
+}{
+	codecs: map[string]BodyCodec{
+		MsgpackEncoding: msgpackCodec{},
+		JSONEncoding:    jsonCodec{},
+	},
+}
+
+// RegisterBodyCodec registers a codec for the given body encoding, which can
+// be used with DecodeBody and EncodeBody. If a codec for the encoding was
+// already registered, the function will panic.
+func RegisterBodyCodec(encoding string, c BodyCodec) {
+	if encoding == "" {
+		panic("missing body encoding")
+	} else if c == nil {
+		panic("missing codec for body encoding " + encoding)
+	}
+
+	bodyCodecs.Lock()
+	defer bodyCodecs.Unlock()
+	if _, has := bodyCodecs.codecs[encoding]; has {
+		panic("body encoding " + encoding + " already registered")
+	}
+	bodyCodecs.codecs[encoding] = c
+}
+
+// DecodeBody decodes the request body of the method call associated with
+// ctx into v. The codec is selected by the body encoding of the request
+// headers, so that a handler can serve clients using different encodings.
+// Requests without a body encoding are decoded as msgpack. If the encoding
+// is not supported or the body is malformed, an InvalidArgument error is
+// returned. Errors of the codec which carry an error code are returned
+// unchanged.
+func DecodeBody(ctx context.Context, body []byte, v interface{}) error {
+	c, err := bodyCodec(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.Decode(body, v); err != nil {
+		if ErrorCode(err) != Unknown {
+			return err
+		}
+		return Errorf(InvalidArgument, "decode body: %s", err.Error())
+	}
+	return nil
+}
+
+// EncodeBody encodes v as response body for the method call associated
+// with ctx with the same codec which is used by DecodeBody.
+func EncodeBody(ctx context.Context, v interface{}) ([]byte, error) {
+	c, err := bodyCodec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Encode(v)
+}
+
+func bodyCodec(ctx context.Context) (BodyCodec, error) {
+	encoding := MsgpackEncoding
+	if info, ok := ctx.Value(responseInfoKey{}).(*responseInfo); ok && info.encoding != "" {
+		encoding = info.encoding
+	}
+
+	bodyCodecs.RLock()
+	c, has := bodyCodecs.codecs[encoding]
+	bodyCodecs.RUnlock()
+	if !has {
+		return nil, Errorf(InvalidArgument, "unsupported body encoding %s", encoding)
+	}
+	return c, nil
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Encode(v interface{}) ([]byte, error) {
+	e, ok := v.(msgpack.Encoder)
+	if !ok {
+		return nil, Errorf(Internal, "%T does not implement msgpack.Encoder", v)
+	}
+
+	var buf bytes.Buffer
+	if err := msgpack.Encode(&buf, e); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Decode(body []byte, v interface{}) error {
+	d, ok := v.(msgpack.Decoder)
+	if !ok {
+		return Errorf(Internal, "%T does not implement msgpack.Decoder", v)
+	}
+	return msgpack.Decode(bytes.NewReader(body), d)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Decode(body []byte, v interface{}) error {
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,197 @@
+package mrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mprot/msgpack-go"
+)
+
+func TestDecodeBody(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t)
+	s.Register(ServiceSpec{
+		Name:    "greeter",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					var g greeting
+					if err := DecodeBody(ctx, body, &g); err != nil {
+						return nil, err
+					}
+					return EncodeBody(ctx, &greeting{Name: "hello " + g.Name})
+				},
+			},
+		},
+	})
+
+	var msgpackBody bytes.Buffer
+	if err := msgpack.Encode(&msgpackBody, &greeting{Name: "msgpack"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jsonBody, err := json.Marshal(greeting{Name: "json"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		encoding string
+		body     []byte
+		decode   func([]byte, *greeting) error
+		code     ErrCode
+		result   string
+	}{
+		{
+			encoding: "",
+			body:     msgpackBody.Bytes(),
+			decode:   func(b []byte, g *greeting) error { return msgpack.Decode(bytes.NewReader(b), g) },
+			result:   "hello msgpack",
+		},
+		{
+			encoding: JSONEncoding,
+			body:     jsonBody,
+			decode:   func(b []byte, g *greeting) error { return json.Unmarshal(b, g) },
+			result:   "hello json",
+		},
+		{
+			encoding: JSONEncoding,
+			body:     msgpackBody.Bytes(),
+			code:     InvalidArgument,
+		},
+		{
+			encoding: "xml",
+			body:     []byte("<greeting/>"),
+			code:     InvalidArgument,
+		},
+	}
+
+	for _, test := range tests {
+		resp := s.Execute(ctx, Request{
+			Service: "greeter",
+			Method:  1,
+			Headers: RequestHeaders{BodyEncoding: test.encoding},
+			Body:    test.body,
+		})
+		if resp.ErrorCode != test.code {
+			t.Fatalf("unexpected error code for encoding %q: %v (%s)", test.encoding, resp.ErrorCode, resp.ErrorText)
+		} else if test.code != OK {
+			continue
+		}
+
+		var g greeting
+		if err := test.decode(resp.Body, &g); err != nil {
+			t.Fatalf("unexpected error for encoding %q: %v", test.encoding, err)
+		} else if g.Name != test.result {
+			t.Fatalf("unexpected result for encoding %q: %q", test.encoding, g.Name)
+		}
+	}
+}
+
+func TestDecodeBodyErrorCodes(t *testing.T) {
+	ctx := context.Background()
+
+	var g greeting
+	if err := DecodeBody(ctx, []byte{0xc1}, &g); ErrorCode(err) != InvalidArgument {
+		t.Fatalf("unexpected error for malformed body: %v", err)
+	}
+
+	// A type without msgpack support is a bug of the server, not the client.
+	var v struct{ Name string }
+	if err := DecodeBody(ctx, []byte{0xc0}, &v); ErrorCode(err) != Internal {
+		t.Fatalf("unexpected error for unsupported type: %v", err)
+	}
+}
+
+func BenchmarkBodyCodec(b *testing.B) {
+	ctx := context.Background()
+
+	s, err := NewServer()
+	if err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+	s.Register(ServiceSpec{
+		Name:    "greeter",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					var g greeting
+					if err := DecodeBody(ctx, body, &g); err != nil {
+						return nil, err
+					}
+					return EncodeBody(ctx, &g)
+				},
+			},
+		},
+	})
+	c := NewClient(newServerConn(s))
+
+	codecs := []struct {
+		encoding string
+		codec    BodyCodec
+	}{
+		{encoding: MsgpackEncoding, codec: msgpackCodec{}},
+		{encoding: JSONEncoding, codec: jsonCodec{}},
+	}
+	sizes := []struct {
+		name string
+		size int
+	}{
+		{name: "small", size: 16},
+		{name: "medium", size: 1024},
+		{name: "large", size: 64 * 1024},
+	}
+
+	for _, codec := range codecs {
+		for _, size := range sizes {
+			b.Run(codec.encoding+"/"+size.name, func(b *testing.B) {
+				g := greeting{Name: string(bytes.Repeat([]byte("x"), size.size))}
+
+				b.ReportAllocs()
+				b.SetBytes(int64(size.size))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					body, err := codec.codec.Encode(&g)
+					if err != nil {
+						b.Fatalf("unexpected error: %v", err)
+					}
+					resp, err := c.Call(ctx, Request{
+						Service: "greeter",
+						Method:  1,
+						Headers: RequestHeaders{BodyEncoding: codec.encoding},
+						Body:    body,
+					})
+					if err == nil {
+						err = ResponseError(resp)
+					}
+					if err != nil {
+						b.Fatalf("unexpected error: %v", err)
+					}
+
+					var result greeting
+					if err := codec.codec.Decode(resp.Body, &result); err != nil {
+						b.Fatalf("unexpected error: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+type greeting struct {
+	Name string
+}
+
+func (g *greeting) EncodeMsgpack(w *msgpack.Writer) error {
+	return w.WriteString(g.Name)
+}
+
+func (g *greeting) DecodeMsgpack(r *msgpack.Reader) (err error) {
+	g.Name, err = r.ReadString()
+	return err
+}
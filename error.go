@@ -2,22 +2,104 @@ package mrpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 )
 
-// ErrorCode determines the error code of the given error.
+// FirstApplicationCode is the lowest error code available for applications.
+// All codes below are reserved for mrpc. Applications can define their own
+// codes starting from this value and pass them to Error or return them from
+// an ErrorCode method of their error types.
+const FirstApplicationCode ErrCode = 1000
+
+var errCodeNames = struct {
+	sync.RWMutex
+	names map[ErrCode]string
+}{
+	names: make(map[ErrCode]string),
+}
+
+// RegisterErrorCode registers a name for an application-defined error code,
+// which is returned by the code's String method. If the code is reserved
+// for mrpc (see FirstApplicationCode) or was already registered, the
+// function will panic.
+func RegisterErrorCode(code ErrCode, name string) {
+	if code < FirstApplicationCode {
+		panic("error code " + strconv.Itoa(int(code)) + " is reserved")
+	} else if name == "" {
+		panic("missing name for error code " + strconv.Itoa(int(code)))
+	}
+
+	errCodeNames.Lock()
+	defer errCodeNames.Unlock()
+	if _, has := errCodeNames.names[code]; has {
+		panic("error code " + strconv.Itoa(int(code)) + " already registered")
+	}
+	errCodeNames.names[code] = name
+}
+
+// String returns the name of the error code, e.g. "NotFound". For
+// application-defined codes, the registered name is returned (see
+// RegisterErrorCode). Unknown codes are formatted as "ErrCode(N)".
+func (c ErrCode) String() string {
+	if name, has := errCodeBuiltinNames[c]; has {
+		return name
+	}
+
+	errCodeNames.RLock()
+	name, has := errCodeNames.names[c]
+	errCodeNames.RUnlock()
+	if has {
+		return name
+	}
+	return "ErrCode(" + strconv.Itoa(int(c)) + ")"
+}
+
+var errCodeBuiltinNames = map[ErrCode]string{
+	OK:                 "OK",
+	Unknown:            "Unknown",
+	Timeout:            "Timeout",
+	NotFound:           "NotFound",
+	AlreadyExists:      "AlreadyExists",
+	InvalidArgument:    "InvalidArgument",
+	Unauthorized:       "Unauthorized",
+	Forbidden:          "Forbidden",
+	Internal:           "Internal",
+	Unavailable:        "Unavailable",
+	ResourceExhausted:  "ResourceExhausted",
+	Canceled:           "Canceled",
+	DataLoss:           "DataLoss",
+	FailedPrecondition: "FailedPrecondition",
+}
+
+// ErrorCode determines the error code of the given error. If the error or
+// any error in its chain (see errors.Unwrap) implements the method
+//
+//	ErrorCode() ErrCode
+//
+// the code of the first such error is returned. This allows handlers to
+// return their own error types or to wrap coded errors, e.g. with
+// fmt.Errorf and the %w verb, without losing the error code. Codes are
+// passed through unchanged, including application-defined codes.
 func ErrorCode(err error) ErrCode {
-	switch err {
-	case nil:
+	if err == nil {
 		return OK
-	case context.DeadlineExceeded:
-		return Timeout
 	}
 
-	if e, ok := err.(interface{ ErrorCode() ErrCode }); ok {
+	var e interface{ ErrorCode() ErrCode }
+	switch {
+	case errors.As(err, &e):
 		return e.ErrorCode()
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	default:
+		return Unknown
 	}
-	return Unknown
 }
 
 // Error returns an error with the given code and error text. If code
@@ -35,20 +117,147 @@ func Errorf(code ErrCode, format string, args ...interface{}) error {
 	return Error(code, fmt.Sprintf(format, args...))
 }
 
-// ResponseError returns the error for the given response.
+// ResponseError returns the error for the given response. It is equivalent
+// to resp.Err().
 func ResponseError(resp Response) error {
+	return resp.Err()
+}
+
+// Code returns the error code of the response.
+func (resp Response) Code() ErrCode {
+	return resp.ErrorCode
+}
+
+// IsError reports whether the response indicates an error.
+func (resp Response) IsError() bool {
+	return resp.ErrorCode != OK
+}
+
+// Err returns the error indicated by the response. If the response does not
+// indicate an error, nil is returned.
+func (resp Response) Err() error {
 	return Error(resp.ErrorCode, resp.ErrorText)
 }
 
-// ErrorResponse returns a response which indicates the given error.
+// ErrorResponse returns a response which indicates the given error. If the
+// error or any error in its chain is a MultiError, the error texts of the
+// aggregated errors are stored in the response's details.
 func ErrorResponse(err error) Response {
-	return Response{ErrorCode: ErrorCode(err), ErrorText: err.Error()}
+	resp := Response{ErrorCode: ErrorCode(err), ErrorText: err.Error()}
+
+	var m *MultiError
+	if errors.As(err, &m) && len(m.errs) != 0 {
+		resp.Details = make([]string, len(m.errs))
+		for i, e := range m.errs {
+			resp.Details[i] = e.Error()
+		}
+	}
+	return resp
 }
 
 func ErrorResponsef(code ErrCode, format string, args ...interface{}) Response {
 	return Response{ErrorCode: code, ErrorText: fmt.Sprintf(format, args...)}
 }
 
+// MultiError aggregates multiple errors, e.g. of a handler which calls
+// several dependencies. Its error code is the most severe code of the
+// aggregated errors, and ErrorResponse reports the
+// error texts of all aggregated errors in the response's details. The zero
+// value is an empty MultiError ready to use. A MultiError is not safe for
+// concurrent use.
+type MultiError struct {
+	errs []error
+}
+
+// Add adds err to the aggregated errors. Nil errors are ignored.
+func (m *MultiError) Add(err error) {
+	if err != nil {
+		m.errs = append(m.errs, err)
+	}
+}
+
+// Errors returns the aggregated errors in the order they were added.
+func (m *MultiError) Errors() []error {
+	return m.errs
+}
+
+// Err returns m, if at least one error was added, and nil otherwise.
+func (m *MultiError) Err() error {
+	if len(m.errs) == 0 {
+		return nil
+	}
+	return m
+}
+
+// ErrorCode returns the most severe error code of the aggregated errors.
+// Errors which indicate a failure of the server or a loss of data are more
+// severe than transient errors, which in turn are more severe than errors
+// caused by the request. From most to least severe, the builtin codes are
+// ordered as follows: DataLoss, Internal, Unknown, Unavailable, Timeout,
+// ResourceExhausted, Canceled, Unauthorized, Forbidden, FailedPrecondition,
+// InvalidArgument, NotFound and AlreadyExists. Application-defined codes are
+// less severe than all builtin codes, the lowest of them is returned. If no
+// error was added, Unknown is returned, because a MultiError which is used
+// as an error always reports a failure. Use Err to get a nil error in this
+// case.
+func (m *MultiError) ErrorCode() ErrCode {
+	if len(m.errs) == 0 {
+		return Unknown
+	}
+
+	code := OK
+	for _, err := range m.errs {
+		c := ErrorCode(err)
+		if s, max := errCodeSeverity(c), errCodeSeverity(code); s > max || (s == max && c < code) {
+			code = c
+		}
+	}
+	return code
+}
+
+// Error returns the error texts of the aggregated errors, separated by
+// semicolons.
+func (m *MultiError) Error() string {
+	texts := make([]string, len(m.errs))
+	for i, err := range m.errs {
+		texts[i] = err.Error()
+	}
+	return strings.Join(texts, "; ")
+}
+
+// Unwrap returns the aggregated errors, so that errors.Is and errors.As
+// examine each of them.
+func (m *MultiError) Unwrap() []error {
+	return m.errs
+}
+
+// errCodeSeverity returns the severity of an error code for determining the
+// code of a MultiError. Higher values are more severe.
+func errCodeSeverity(c ErrCode) int {
+	if s, has := errCodeSeverities[c]; has {
+		return s
+	} else if c == OK {
+		return 0
+	}
+	return 1
+}
+
+var errCodeSeverities = map[ErrCode]int{
+	DataLoss:           14,
+	Internal:           13,
+	Unknown:            12,
+	Unavailable:        11,
+	Timeout:            10,
+	ResourceExhausted:  9,
+	Canceled:           8,
+	Unauthorized:       7,
+	Forbidden:          6,
+	FailedPrecondition: 5,
+	InvalidArgument:    4,
+	NotFound:           3,
+	AlreadyExists:      2,
+}
+
 type codeError struct {
 	code ErrCode
 	text string
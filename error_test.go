@@ -0,0 +1,183 @@
+package mrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code ErrCode
+	}{
+		{nil, OK},
+		{errors.New("error"), Unknown},
+		{context.DeadlineExceeded, Timeout},
+		{context.Canceled, Canceled},
+		{Error(NotFound, "not found"), NotFound},
+		{fmt.Errorf("wrapped: %w", Error(NotFound, "not found")), NotFound},
+		{fmt.Errorf("wrapped: %w", context.Canceled), Canceled},
+		{fmt.Errorf("wrapped: %w", appError{code: Forbidden}), Forbidden},
+		{appError{code: InvalidArgument, cause: context.Canceled}, InvalidArgument},
+		{appError{code: FirstApplicationCode + 7}, FirstApplicationCode + 7},
+	}
+
+	for _, test := range tests {
+		if code := ErrorCode(test.err); code != test.code {
+			t.Errorf("unexpected error code for %v: %v (expected %v)", test.err, code, test.code)
+		}
+	}
+}
+
+func TestErrCodeString(t *testing.T) {
+	tests := []struct {
+		code ErrCode
+		name string
+	}{
+		{OK, "OK"},
+		{Unknown, "Unknown"},
+		{Timeout, "Timeout"},
+		{NotFound, "NotFound"},
+		{AlreadyExists, "AlreadyExists"},
+		{InvalidArgument, "InvalidArgument"},
+		{Unauthorized, "Unauthorized"},
+		{Forbidden, "Forbidden"},
+		{Internal, "Internal"},
+		{Unavailable, "Unavailable"},
+		{ResourceExhausted, "ResourceExhausted"},
+		{Canceled, "Canceled"},
+		{DataLoss, "DataLoss"},
+		{FailedPrecondition, "FailedPrecondition"},
+		{ErrCode(-1), "ErrCode(-1)"},
+		{ErrCode(999), "ErrCode(999)"},
+	}
+
+	for _, test := range tests {
+		if name := test.code.String(); name != test.name {
+			t.Errorf("unexpected name for code %d: %q (expected %q)", int(test.code), name, test.name)
+		}
+	}
+}
+
+func TestRegisterErrorCode(t *testing.T) {
+	const code = FirstApplicationCode + 42
+	RegisterErrorCode(code, "OutOfStock")
+
+	if s := code.String(); s != "OutOfStock" {
+		t.Fatalf("unexpected name: %q", s)
+	}
+	if s := (code + 1).String(); s != "ErrCode(1043)" {
+		t.Fatalf("unexpected name of unregistered code: %q", s)
+	}
+
+	panics := []struct {
+		name string
+		code ErrCode
+	}{
+		{"reserved", FirstApplicationCode - 1},
+		{"duplicate", code},
+	}
+	for _, p := range panics {
+		t.Run(p.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected panic for code %d", p.code)
+				}
+			}()
+			RegisterErrorCode(p.code, "Name")
+		})
+	}
+}
+
+type appError struct {
+	code  ErrCode
+	cause error
+}
+
+func (e appError) ErrorCode() ErrCode { return e.code }
+func (e appError) Error() string      { return "application error" }
+func (e appError) Unwrap() error      { return e.cause }
+
+func TestMultiError(t *testing.T) {
+	tests := []struct {
+		errs []error
+		code ErrCode
+	}{
+		{nil, OK},
+		{[]error{nil}, OK},
+		{[]error{Error(NotFound, "not found")}, NotFound},
+		{[]error{Error(NotFound, "not found"), Error(InvalidArgument, "invalid")}, InvalidArgument},
+		{[]error{Error(Timeout, "timeout"), Error(Unavailable, "unavailable"), Error(NotFound, "not found")}, Unavailable},
+		{[]error{Error(Unavailable, "unavailable"), errors.New("unknown")}, Unknown},
+		{[]error{Error(Internal, "internal"), Error(DataLoss, "data loss")}, DataLoss},
+		{[]error{appError{code: FirstApplicationCode}, Error(AlreadyExists, "exists")}, AlreadyExists},
+		{[]error{appError{code: FirstApplicationCode + 2}, appError{code: FirstApplicationCode + 1}}, FirstApplicationCode + 1},
+	}
+
+	for _, test := range tests {
+		var m MultiError
+		for _, err := range test.errs {
+			m.Add(err)
+		}
+		if code := ErrorCode(m.Err()); code != test.code {
+			t.Errorf("unexpected error code for %v: %v (expected %v)", test.errs, code, test.code)
+		}
+	}
+
+	// An empty MultiError used as an error still reports a failure.
+	var empty MultiError
+	if code := ErrorCode(&empty); code != Unknown {
+		t.Fatalf("unexpected error code of an empty MultiError: %v", code)
+	} else if resp := ErrorResponse(&empty); !resp.IsError() {
+		t.Fatalf("unexpected response of an empty MultiError: %+v", resp)
+	}
+
+	var m MultiError
+	m.Add(Error(NotFound, "user not found"))
+	m.Add(fmt.Errorf("fetch orders: %w", context.DeadlineExceeded))
+
+	err := fmt.Errorf("aggregate: %w", m.Err())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("aggregated error not found: %v", err)
+	}
+
+	resp := ErrorResponse(err)
+	expected := Response{
+		ErrorCode: Timeout,
+		ErrorText: "aggregate: user not found; fetch orders: context deadline exceeded",
+		Details:   []string{"user not found", "fetch orders: context deadline exceeded"},
+	}
+	if !reflect.DeepEqual(resp, expected) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	var decoded Response
+	roundTrip(t, &resp, &decoded)
+	if !reflect.DeepEqual(decoded.Details, expected.Details) {
+		t.Fatalf("unexpected decoded details: %q", decoded.Details)
+	}
+}
+
+func TestResponseErrorMethods(t *testing.T) {
+	responses := []Response{
+		{},
+		{Body: []byte("body")},
+		{ErrorCode: NotFound, ErrorText: "not found"},
+		{ErrorCode: Internal},
+	}
+
+	for _, resp := range responses {
+		err := ResponseError(resp)
+		switch {
+		case resp.IsError() != (err != nil):
+			t.Fatalf("unexpected IsError for %v: %v", resp, resp.IsError())
+		case resp.Code() != ErrorCode(err):
+			t.Fatalf("unexpected Code for %v: %v", resp, resp.Code())
+		case !reflect.DeepEqual(resp.Err(), err):
+			t.Fatalf("unexpected Err for %v: %v", resp, resp.Err())
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package mrpc_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	mrpc "github.com/mprot/mrpc-go"
+)
+
+// This example encrypts the request and response bodies with interceptors.
+// The client interceptor receives the request by value, so the encrypted
+// body it passes on is what is written to the connection.
+func Example_bodyEncryption() {
+	block, err := aes.NewCipher([]byte("0123456789abcdef"))
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+
+	encrypt := func(plain []byte) []byte {
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			panic(err)
+		}
+		return aead.Seal(nonce, nonce, plain, nil)
+	}
+	decrypt := func(data []byte) ([]byte, error) {
+		if len(data) < aead.NonceSize() {
+			return nil, mrpc.Error(mrpc.InvalidArgument, "invalid encrypted body")
+		}
+		nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+		return aead.Open(nil, nonce, sealed, nil)
+	}
+
+	server, err := mrpc.NewServer(mrpc.WithServerInterceptor(func(ctx context.Context, call mrpc.CallInfo, h mrpc.Handler) ([]byte, error) {
+		body, err := decrypt(call.Body)
+		if err != nil {
+			return nil, mrpc.Error(mrpc.InvalidArgument, "decrypt request: "+err.Error())
+		}
+		resp, err := h(ctx, call.Service, body)
+		if err != nil {
+			return nil, err
+		}
+		return encrypt(resp), nil
+	}))
+	if err != nil {
+		panic(err)
+	}
+	server.Register(mrpc.ServiceSpec{
+		Name:    "greeter",
+		Service: struct{}{},
+		Methods: []mrpc.MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return []byte("hello " + string(body)), nil
+				},
+			},
+		},
+	})
+
+	conn := &loopbackConn{server: server}
+	client := mrpc.NewClient(conn, mrpc.WithClientInterceptor(func(ctx context.Context, req mrpc.Request, c mrpc.Caller) (mrpc.Response, error) {
+		req.Body = encrypt(req.Body)
+		resp, err := c.Call(ctx, req)
+		if err != nil || resp.IsError() {
+			return resp, err
+		}
+		if resp.Body, err = decrypt(resp.Body); err != nil {
+			return resp, mrpc.Error(mrpc.DataLoss, "decrypt response: "+err.Error())
+		}
+		return resp, nil
+	}))
+
+	resp, err := client.Call(context.Background(), mrpc.Request{Service: "greeter", Method: 1, Body: []byte("world")})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(resp.Body))
+	fmt.Println(bytes.Contains(conn.written, []byte("world")))
+	// Output:
+	// hello world
+	// false
+}
+
+// loopbackConn serves each written request with a server and records all
+// written bytes.
+type loopbackConn struct {
+	server  *mrpc.Server
+	written []byte
+	resp    bytes.Buffer
+}
+
+func (c *loopbackConn) Write(p []byte) (int, error) {
+	c.written = append(c.written, p...)
+	if err := c.server.ServeMRPC(context.Background(), bytes.NewReader(p), &c.resp); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *loopbackConn) Read(p []byte) (int, error) {
+	return c.resp.Read(p)
+}
@@ -0,0 +1,46 @@
+package mrpc
+
+import (
+	"context"
+)
+
+// NewFailoverCaller returns a caller, which calls the primary caller first.
+// If shouldFailover reports true for the primary's result, the call is
+// repeated on the secondary caller and its result is returned instead. If
+// shouldFailover is nil, DefaultFailover is used.
+func NewFailoverCaller(primary, secondary Caller, shouldFailover func(Response, error) bool) Caller {
+	if shouldFailover == nil {
+		shouldFailover = DefaultFailover
+	}
+
+	return CallerFunc(func(ctx context.Context, req Request) (Response, error) {
+		// The primary caller gets a copy of the request, so that the
+		// secondary caller sees the original request in any case.
+		resp, err := primary.Call(ctx, copyRequest(req))
+		if !shouldFailover(resp, err) {
+			return resp, err
+		}
+		return secondary.Call(ctx, req)
+	})
+}
+
+// DefaultFailover reports whether a call should be repeated on a secondary
+// caller. This is the case for transport errors and responses with the
+// Unavailable error code.
+func DefaultFailover(resp Response, err error) bool {
+	return err != nil || resp.ErrorCode == Unavailable
+}
+
+func copyRequest(req Request) Request {
+	if req.Body != nil {
+		req.Body = append([]byte(nil), req.Body...)
+	}
+	if req.Headers.Metadata != nil {
+		metadata := make(map[string]string, len(req.Headers.Metadata))
+		for k, v := range req.Headers.Metadata {
+			metadata[k] = v
+		}
+		req.Headers.Metadata = metadata
+	}
+	return req
+}
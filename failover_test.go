@@ -0,0 +1,58 @@
+package mrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFailoverCaller(t *testing.T) {
+	ctx := context.Background()
+
+	tests := map[string]struct {
+		resp     Response
+		err      error
+		failover bool
+	}{
+		"success":          {resp: Response{Body: []byte("primary")}},
+		"transport-error":  {err: errors.New("connection reset"), failover: true},
+		"unavailable":      {resp: Response{ErrorCode: Unavailable}, failover: true},
+		"invalid-argument": {resp: Response{ErrorCode: InvalidArgument}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			primary := CallerFunc(func(ctx context.Context, req Request) (Response, error) {
+				// must not be visible to the secondary
+				req.Body[0] = 'X'
+				req.Headers.Metadata["token"] = "changed"
+				return test.resp, test.err
+			})
+
+			secondaryCalled := false
+			secondary := CallerFunc(func(ctx context.Context, req Request) (Response, error) {
+				secondaryCalled = true
+				if string(req.Body) != "request" {
+					t.Fatalf("unexpected request body: %q", req.Body)
+				} else if req.Headers.Metadata["token"] != "original" {
+					t.Fatalf("unexpected request metadata: %v", req.Headers.Metadata)
+				}
+				return Response{Body: []byte("secondary")}, nil
+			})
+
+			caller := NewFailoverCaller(primary, secondary, nil)
+			resp, err := caller.Call(ctx, Request{
+				Headers: RequestHeaders{Metadata: map[string]string{"token": "original"}},
+				Body:    []byte("request"),
+			})
+			switch {
+			case secondaryCalled != test.failover:
+				t.Fatalf("unexpected failover: %v", secondaryCalled)
+			case test.failover && (err != nil || string(resp.Body) != "secondary"):
+				t.Fatalf("unexpected result: %v, %v", resp, err)
+			case !test.failover && (err != test.err || resp.ErrorCode != test.resp.ErrorCode):
+				t.Fatalf("unexpected result: %v, %v", resp, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+//go:build go1.18
+
+package mrpc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/mprot/msgpack-go"
+)
+
+// FuzzServeMRPC feeds arbitrary input to ServeMRPC and checks that a
+// decodable response is written for each input. Run it with
+//
+//	go test -run '^$' -fuzz FuzzServeMRPC
+func FuzzServeMRPC(f *testing.F) {
+	s, err := NewServer()
+	if err != nil {
+		f.Fatalf("unexpected error: %v", err)
+	}
+	s.Register(ServiceSpec{
+		Name:    "echo",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return body, nil
+				},
+			},
+		},
+	})
+
+	seeds := []Request{
+		{Service: "echo", Method: 1, Body: []byte("body")},
+		{Service: "echo", Method: 2, Headers: RequestHeaders{Timeout: 1e9, RequestID: "id"}},
+		{Service: "unknown", Method: 1, Headers: RequestHeaders{MethodVersion: 3, Priority: PriorityHigh}},
+	}
+	for _, req := range seeds {
+		var buf bytes.Buffer
+		if err := msgpack.Encode(&buf, &req); err != nil {
+			f.Fatalf("unexpected error: %v", err)
+		}
+		f.Add(buf.Bytes())
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0xdf, 0xff, 0xff, 0xff, 0xff})
+
+	// A request whose metadata header announces 2^32-1 entries must not
+	// make the decoder allocate memory for all of them.
+	var forged bytes.Buffer
+	w := msgpack.NewWriter(&forged)
+	w.WriteMapHeader(1)
+	w.WriteInt64(3) // Headers
+	w.WriteMapHeader(1)
+	w.WriteInt64(8) // Metadata
+	f.Add(append(forged.Bytes(), 0xdf, 0xff, 0xff, 0xff, 0xff))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var out bytes.Buffer
+		if err := s.ServeMRPC(context.Background(), bytes.NewReader(data), &out); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var resp Response
+		if err := msgpack.Decode(&out, &resp); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+
+		var req Request
+		if msgpack.Decode(bytes.NewReader(data), &req) != nil && resp.ErrorCode == OK {
+			t.Fatalf("no error response for malformed request %x", data)
+		}
+	})
+}
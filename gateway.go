@@ -0,0 +1,182 @@
+package mrpc
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONGateway returns an HTTP handler which exposes the methods of s as
+// JSON endpoints. A method is called with a POST request to
+//
+//	{prefix}/{service}/{method id}
+//
+// The JSON request body is passed to the method's handler as is, and the
+// body returned by the handler is written as the JSON response. Therefore
+// the gateway is only meant for methods which exchange JSON bodies. The
+// requests carry the JSONEncoding body encoding, so that handlers can use
+// DecodeBody and EncodeBody to serve gateway and msgpack clients. Errors
+// are reported with an HTTP status code derived from the error code (see
+// HTTPStatus) and a JSON body of the form
+//
+//	{"code": <error code>, "error": <error text>}
+//
+// Successful responses larger than 1KB are compressed with gzip, if the
+// HTTP client accepts it (see the Accept-Encoding header). Request bodies
+// larger than 4MB are rejected with the status 413.
+//
+// The response metadata is written as HTTP headers prefixed with
+// "Mrpc-Metadata-", and each warning as an "Mrpc-Warning" header. A retry
+// duration (see RetryAfterKey) is additionally written as the Retry-After
+// header in seconds.
+func JSONGateway(s *Server, prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSONError(w, Error(InvalidArgument, "method not allowed"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, prefix)
+		idx := strings.LastIndexByte(path, '/')
+		if len(path) == len(r.URL.Path) || idx <= 0 {
+			writeJSONError(w, Errorf(NotFound, "path %s not found", r.URL.Path), http.StatusNotFound)
+			return
+		}
+		method, err := strconv.Atoi(path[idx+1:])
+		if err != nil {
+			writeJSONError(w, Errorf(NotFound, "path %s not found", r.URL.Path), http.StatusNotFound)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, gatewayMaxBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSONError(w, Errorf(InvalidArgument, "request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+				return
+			}
+			writeJSONError(w, Errorf(InvalidArgument, "read request body: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		if len(body) != 0 && !json.Valid(body) {
+			writeJSONError(w, Error(InvalidArgument, "invalid json request body"), http.StatusBadRequest)
+			return
+		}
+
+		resp := s.Execute(r.Context(), Request{
+			Service: path[:idx],
+			Method:  method,
+			Headers: RequestHeaders{Version: ProtocolVersion, BodyEncoding: JSONEncoding},
+			Body:    body,
+		})
+		writeResponseHeaders(w.Header(), resp)
+		if err := resp.Err(); err != nil {
+			writeJSONError(w, err, HTTPStatus(resp.ErrorCode))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Add("Vary", "Accept-Encoding")
+		if len(resp.Body) < gzipMinSize || !acceptsGzip(r) {
+			w.Write(resp.Body)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write(resp.Body)
+		gz.Close()
+	})
+}
+
+// gatewayMaxBodySize is the maximum size of request bodies accepted by the
+// gateway.
+const gatewayMaxBodySize = 4 << 20
+
+// writeResponseHeaders writes the metadata and warnings of resp to h.
+func writeResponseHeaders(h http.Header, resp Response) {
+	for key, value := range resp.Metadata {
+		h.Set("Mrpc-Metadata-"+key, value)
+	}
+	for _, warning := range resp.Warnings {
+		h.Add("Mrpc-Warning", warning)
+	}
+	if d, err := time.ParseDuration(resp.Metadata[RetryAfterKey]); err == nil && d >= 0 {
+		h.Set("Retry-After", strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10))
+	}
+}
+
+// gzipMinSize is the minimum size of response bodies compressed by the
+// gateway. Smaller bodies are not worth the overhead.
+const gzipMinSize = 1024
+
+// acceptsGzip reports whether the HTTP client accepts gzip encoded bodies.
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, enc := range strings.Split(v, ",") {
+			name, params, _ := strings.Cut(enc, ";")
+			if strings.TrimSpace(name) != "gzip" {
+				continue
+			}
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if w, err := strconv.ParseFloat(q, 64); err == nil && w == 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPStatus returns the HTTP status code which corresponds to the given
+// error code.
+func HTTPStatus(code ErrCode) int {
+	switch code {
+	case OK:
+		return http.StatusOK
+	case Timeout:
+		return http.StatusGatewayTimeout
+	case NotFound:
+		return http.StatusNotFound
+	case AlreadyExists:
+		return http.StatusConflict
+	case InvalidArgument:
+		return http.StatusBadRequest
+	case Unauthorized:
+		return http.StatusUnauthorized
+	case Forbidden:
+		return http.StatusForbidden
+	case Unavailable:
+		return http.StatusServiceUnavailable
+	case ResourceExhausted:
+		return http.StatusTooManyRequests
+	case FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case Canceled:
+		return 499 // client closed request
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, err error, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Code  ErrCode `json:"code"`
+		Error string  `json:"error"`
+	}{
+		Code:  ErrorCode(err),
+		Error: err.Error(),
+	})
+}
@@ -0,0 +1,216 @@
+package mrpc
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONGateway(t *testing.T) {
+	s := newServer(t)
+	s.Register(ServiceSpec{
+		Name:    "billing.invoices",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					var req struct{ ID int }
+					if err := DecodeBody(ctx, body, &req); err != nil {
+						return nil, err
+					}
+					return EncodeBody(ctx, map[string]int{"invoice": req.ID})
+				},
+			},
+			{
+				ID: 2,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return nil, Error(Forbidden, "forbidden")
+				},
+			},
+		},
+	})
+
+	gateway := JSONGateway(s, "/api/")
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		result string
+	}{
+		{method: "POST", path: "/api/billing.invoices/1", body: `{"ID": 7}`, status: http.StatusOK, result: `{"invoice":7}`},
+		{method: "POST", path: "/api/billing.invoices/2", body: `{}`, status: http.StatusForbidden, result: `{"code":7,"error":"forbidden"}`},
+		{method: "POST", path: "/api/billing.invoices/3", body: `{}`, status: http.StatusNotFound, result: `{"code":3,"error":"method billing.invoices:3 not found"}`},
+		{method: "POST", path: "/api/billing.invoices/1", body: `{`, status: http.StatusBadRequest, result: `{"code":5,"error":"invalid json request body"}`},
+		{method: "POST", path: "/api/billing.invoices", body: `{}`, status: http.StatusNotFound, result: `{"code":3,"error":"path /api/billing.invoices not found"}`},
+		{method: "POST", path: "/other/billing.invoices/1", body: `{}`, status: http.StatusNotFound, result: `{"code":3,"error":"path /other/billing.invoices/1 not found"}`},
+		{method: "GET", path: "/api/billing.invoices/1", status: http.StatusMethodNotAllowed, result: `{"code":5,"error":"method not allowed"}`},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		gateway.ServeHTTP(rec, httptest.NewRequest(test.method, test.path, strings.NewReader(test.body)))
+
+		if rec.Code != test.status {
+			t.Fatalf("unexpected status for %s %s: %d", test.method, test.path, rec.Code)
+		} else if result := strings.TrimSpace(rec.Body.String()); result != test.result {
+			t.Fatalf("unexpected result for %s %s: %s", test.method, test.path, result)
+		} else if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("unexpected content type for %s %s: %s", test.method, test.path, ct)
+		}
+	}
+}
+
+func TestJSONGatewayProtocolVersions(t *testing.T) {
+	s := newServer(t, WithProtocolVersions(ProtocolVersion, ProtocolVersion))
+	s.Register(ServiceSpec{
+		Name:    "greeter",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return []byte(`"hello"`), nil
+				},
+			},
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	JSONGateway(s, "/api").ServeHTTP(rec, httptest.NewRequest("POST", "/api/greeter/1", strings.NewReader(`{}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d (%s)", rec.Code, rec.Body.String())
+	} else if body := rec.Body.String(); body != `"hello"` {
+		t.Fatalf("unexpected result: %s", body)
+	}
+}
+
+func TestJSONGatewayResponseHeaders(t *testing.T) {
+	s := newServer(t)
+	s.Register(ServiceSpec{
+		Name:    "greeter",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					SetResponseMetadata(ctx, RetryAfterKey, "1500ms")
+					AddResponseWarning(ctx, "first warning")
+					AddResponseWarning(ctx, "second warning")
+					return nil, Error(ResourceExhausted, "busy")
+				},
+			},
+		},
+	})
+
+	rec := httptest.NewRecorder()
+	JSONGateway(s, "/api").ServeHTTP(rec, httptest.NewRequest("POST", "/api/greeter/1", strings.NewReader(`{}`)))
+
+	h := rec.Header()
+	switch {
+	case rec.Code != http.StatusTooManyRequests:
+		t.Fatalf("unexpected status: %d", rec.Code)
+	case h.Get("Retry-After") != "2":
+		t.Fatalf("unexpected Retry-After header: %q", h.Get("Retry-After"))
+	case h.Get("Mrpc-Metadata-"+RetryAfterKey) != "1500ms":
+		t.Fatalf("unexpected metadata header: %q", h.Get("Mrpc-Metadata-"+RetryAfterKey))
+	case !reflect.DeepEqual(h.Values("Mrpc-Warning"), []string{"first warning", "second warning"}):
+		t.Fatalf("unexpected warning headers: %q", h.Values("Mrpc-Warning"))
+	}
+}
+
+func TestJSONGatewayMaxBodySize(t *testing.T) {
+	s := newServer(t)
+	s.Register(ServiceSpec{
+		Name:    "greeter",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return body, nil
+				},
+			},
+		},
+	})
+	gateway := JSONGateway(s, "/api")
+
+	body := `"` + strings.Repeat("x", gatewayMaxBodySize-2) + `"`
+	rec := httptest.NewRecorder()
+	gateway.ServeHTTP(rec, httptest.NewRequest("POST", "/api/greeter/1", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status for body of maximum size: %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	gateway.ServeHTTP(rec, httptest.NewRequest("POST", "/api/greeter/1", strings.NewReader(body+" ")))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("unexpected status for too large body: %d", rec.Code)
+	}
+}
+
+func TestJSONGatewayGzip(t *testing.T) {
+	large := `"` + strings.Repeat("x", gzipMinSize) + `"`
+
+	s := newServer(t)
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return body, nil
+				},
+			},
+		},
+	})
+
+	gateway := JSONGateway(s, "/api")
+
+	tests := []struct {
+		body           string
+		acceptEncoding string
+		gzipped        bool
+	}{
+		{body: large, acceptEncoding: "", gzipped: false},
+		{body: large, acceptEncoding: "gzip", gzipped: true},
+		{body: large, acceptEncoding: "deflate, gzip;q=0.5", gzipped: true},
+		{body: large, acceptEncoding: "gzip;q=0", gzipped: false},
+		{body: `"small"`, acceptEncoding: "gzip", gzipped: false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/api/my-service/1", strings.NewReader(test.body))
+		if test.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		gateway.ServeHTTP(rec, req)
+
+		body := io.Reader(rec.Body)
+		if gzipped := rec.Header().Get("Content-Encoding") == "gzip"; gzipped != test.gzipped {
+			t.Fatalf("unexpected gzip encoding for %q: %v", test.acceptEncoding, gzipped)
+		} else if gzipped {
+			gz, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			body = gz
+		}
+
+		result, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if string(result) != test.body {
+			t.Fatalf("unexpected result for %q: %.20s", test.acceptEncoding, result)
+		}
+	}
+}
@@ -1,3 +1,3 @@
 package mrpc
 
-//go:generate mprotc go --root ../mprot/ mrpc.mprot
+//go:generate mprotc go --root . mrpc.mprot
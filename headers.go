@@ -0,0 +1,212 @@
+package mrpc
+
+import (
+	msgpack "github.com/mprot/msgpack-go"
+)
+
+// decodeLimitedRequest decodes a request like Request.DecodeMsgpack, but
+// aborts with a ResourceExhausted error as soon as the encoded size of the
+// request headers exceeds max bytes (see WithMaxHeaderSize).
+func decodeLimitedRequest(r *msgpack.Reader, req *Request, max int) error {
+	n, err := r.ReadMapHeader()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		ord, err := r.ReadInt64()
+		if err != nil {
+			return err
+		}
+		switch ord {
+		case 1: // Service
+			if req.Service, err = r.ReadString(); err != nil {
+				return err
+			}
+		case 2: // Method
+			if req.Method, err = r.ReadInt(); err != nil {
+				return err
+			}
+		case 3: // Headers
+			d := headerDecoder{r: r, max: max}
+			if err = d.decode(&req.Headers); err != nil {
+				return err
+			}
+		case 4: // Body
+			if req.Body, err = r.ReadBytes(nil); err != nil {
+				return err
+			}
+		default:
+			if err := r.Skip(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// headerDecoder decodes request headers and sums up the size of their
+// msgpack encoding while decoding. Unknown fields are skipped without being
+// counted, because they are not kept.
+type headerDecoder struct {
+	r    *msgpack.Reader
+	max  int
+	size int
+}
+
+func (d *headerDecoder) decode(h *RequestHeaders) error {
+	n, err := d.r.ReadMapHeader()
+	if err != nil {
+		return err
+	} else if err = d.add(mapHeaderSize(n)); err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		ord, err := d.r.ReadInt64()
+		if err != nil {
+			return err
+		} else if err = d.add(intSize(ord)); err != nil {
+			return err
+		}
+
+		switch ord {
+		case 1: // Timeout
+			if h.Timeout, err = d.r.ReadUint64(); err == nil {
+				err = d.add(uintSize(h.Timeout))
+			}
+		case 2: // RequestID
+			h.RequestID, err = d.readString()
+		case 3: // Hops
+			if h.Hops, err = d.r.ReadUint8(); err == nil {
+				err = d.add(uintSize(uint64(h.Hops)))
+			}
+		case 4: // MethodVersion
+			if h.MethodVersion, err = d.r.ReadInt(); err == nil {
+				err = d.add(intSize(int64(h.MethodVersion)))
+			}
+		case 5: // Checksum
+			if h.Checksum, err = d.r.ReadUint64(); err == nil {
+				err = d.add(uintSize(h.Checksum))
+			}
+		case 6: // Priority
+			if h.Priority, err = d.r.ReadUint8(); err == nil {
+				err = d.add(uintSize(uint64(h.Priority)))
+			}
+		case 7: // Version
+			if h.Version, err = d.r.ReadUint8(); err == nil {
+				err = d.add(uintSize(uint64(h.Version)))
+			}
+		case 8: // Metadata
+			h.Metadata, err = d.readMetadata()
+		case 9: // BodyEncoding
+			h.BodyEncoding, err = d.readString()
+		default:
+			err = d.r.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *headerDecoder) readMetadata() (map[string]string, error) {
+	n, err := d.r.ReadMapHeader()
+	if err != nil {
+		return nil, err
+	} else if err = d.add(mapHeaderSize(n)); err != nil {
+		return nil, err
+	}
+	// Each entry takes at least two bytes, so a forged length is rejected
+	// before reading the entries.
+	if n > (d.max-d.size)/2 {
+		return nil, d.exceeded()
+	} else if n == 0 {
+		return nil, nil
+	}
+
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		k, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		if m[k], err = d.readString(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (d *headerDecoder) readString() (string, error) {
+	s, err := d.r.ReadString()
+	if err != nil {
+		return "", err
+	}
+	return s, d.add(stringSize(len(s)))
+}
+
+func (d *headerDecoder) add(n int) error {
+	if d.size += n; d.size > d.max {
+		return d.exceeded()
+	}
+	return nil
+}
+
+func (d *headerDecoder) exceeded() error {
+	return Errorf(ResourceExhausted, "request headers exceed the maximum of %d bytes", d.max)
+}
+
+// The following functions return the size of the shortest msgpack encoding
+// of a value.
+
+func uintSize(v uint64) int {
+	switch {
+	case v < 1<<7:
+		return 1
+	case v < 1<<8:
+		return 2
+	case v < 1<<16:
+		return 3
+	case v < 1<<32:
+		return 5
+	}
+	return 9
+}
+
+func intSize(v int64) int {
+	switch {
+	case v >= 0:
+		return uintSize(uint64(v))
+	case v >= -1<<5:
+		return 1
+	case v >= -1<<7:
+		return 2
+	case v >= -1<<15:
+		return 3
+	case v >= -1<<31:
+		return 5
+	}
+	return 9
+}
+
+func stringSize(n int) int {
+	switch {
+	case n < 1<<5:
+		return 1 + n
+	case n < 1<<8:
+		return 2 + n
+	case n < 1<<16:
+		return 3 + n
+	}
+	return 5 + n
+}
+
+func mapHeaderSize(n int) int {
+	switch {
+	case n < 1<<4:
+		return 1
+	case n < 1<<16:
+		return 3
+	}
+	return 5
+}
@@ -0,0 +1,46 @@
+package mrpc
+
+import (
+	"context"
+)
+
+// The hop count limits the length of call chains in a service mesh, where
+// a handler calls other services while serving a request. Each server in
+// the mesh installs MaxHopsInterceptor and each client which is used from
+// within handlers installs HopsInterceptor. When such a client is called
+// with the handler's context, the outgoing request carries the incoming
+// hop count increased by one. A request exceeding the maximum number of
+// hops is rejected, which bounds the amplification of cascading retries.
+
+// HopsInterceptor returns a client interceptor which sets the hop count of
+// outgoing requests to the hop count of the incoming request associated
+// with ctx, increased by one. A hop count which was already set on the
+// request is only ever increased.
+func HopsInterceptor() ClientInterceptor {
+	return func(ctx context.Context, req Request, c Caller) (Response, error) {
+		hops, _ := ctx.Value(hopsKey{}).(uint8)
+		if hops < ^uint8(0) {
+			hops++
+		}
+		if hops > req.Headers.Hops {
+			req.Headers.Hops = hops
+		}
+		return c.Call(ctx, req)
+	}
+}
+
+// MaxHopsInterceptor returns a server interceptor which rejects requests
+// with a hop count greater than max with a ResourceExhausted error. The hop
+// count of accepted requests is stored in the handler's context, where it
+// is picked up by HopsInterceptor.
+func MaxHopsInterceptor(max uint8) ServerInterceptor {
+	return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		hops := call.Headers.Hops
+		if hops > max {
+			return nil, Errorf(ResourceExhausted, "maximum number of hops exceeded (%d > %d)", hops, max)
+		}
+		return h(context.WithValue(ctx, hopsKey{}, hops), call.Service, call.Body)
+	}
+}
+
+type hopsKey struct{}
@@ -0,0 +1,57 @@
+package mrpc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHops(t *testing.T) {
+	ctx := context.Background()
+
+	var hops []uint8
+	s := newServer(t, WithServerInterceptor(MaxHopsInterceptor(2)))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					client := NewClient(newClientConn(func(req Request) Response {
+						hops = append(hops, req.Headers.Hops)
+						return Response{}
+					}), WithClientInterceptor(HopsInterceptor()))
+
+					_, err := client.Call(ctx, Request{Service: "other-service"})
+					return nil, err
+				},
+			},
+		},
+	})
+
+	for _, h := range []uint8{0, 2} {
+		resp := s.Execute(ctx, Request{
+			Service: "my-service",
+			Method:  1,
+			Headers: RequestHeaders{Hops: h},
+		})
+		if err := ResponseError(resp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(hops) != 2 || hops[0] != 1 || hops[1] != 3 {
+		t.Fatalf("unexpected outgoing hops: %v", hops)
+	}
+
+	resp := s.Execute(ctx, Request{
+		Service: "my-service",
+		Method:  1,
+		Headers: RequestHeaders{Hops: 3},
+	})
+	if resp.ErrorCode != ResourceExhausted {
+		t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+	} else if len(hops) != 2 {
+		t.Fatalf("unexpected outgoing call: %v", hops)
+	}
+}
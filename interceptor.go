@@ -2,20 +2,112 @@ package mrpc
 
 import (
 	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// CallInfo holds details about a method call on the server side.
+// CallInfo holds details about a method call on the server side. Values
+// holds the values of the call, which are shared by all interceptors and
+// the handler (see Values).
 type CallInfo struct {
 	Service interface{}
 	Method  string
+	Headers RequestHeaders
 	Body    []byte
+	Values  *Values
 }
 
 // ServerInterceptor defines a function type for intercepting a request on
 // the server side. The interceptor is responsible to call h to complete the
-// method call.
+// method call. The service and body passed to h are passed on to the
+// following interceptors and the handler. An interceptor which returns
+// without calling h short-circuits the call: the handler is never executed
+// and the returned body and error are used as the method's result (see
+// Respond). Calling h after the interceptor returned only executes the
+// remaining interceptors and the handler of the same call, and its result
+// is discarded.
 type ServerInterceptor func(ctx context.Context, call CallInfo, h Handler) ([]byte, error)
 
+// NamedInterceptor is a server interceptor carrying a name. The name is only
+// used for introspection (see Server.InterceptorChain) and does not need to
+// be unique.
+type NamedInterceptor struct {
+	Name        string
+	Interceptor ServerInterceptor
+}
+
+// TransportInterceptor defines a function type for intercepting the raw
+// requests served by Server.ServeMRPC. In contrast to a ServerInterceptor,
+// it wraps the decoding of the request and the encoding of the response,
+// e.g. for measuring the total serialization cost or for encrypting whole
+// messages. The function next decodes and executes the request passed to
+// it and returns the encoded response. An error returned by the interceptor
+// is returned by ServeMRPC and no response is written.
+type TransportInterceptor func(ctx context.Context, raw []byte, next func([]byte) ([]byte, error)) ([]byte, error)
+
+// Middleware defines a function type for wrapping a handler on the server
+// side. Middlewares are a simpler alternative to server interceptors for
+// behavior which applies to all methods alike, e.g. authentication or
+// panic recovery. Use a ServerInterceptor instead, if the method name or
+// the request headers are needed.
+type Middleware func(h Handler) Handler
+
+func (m Middleware) interceptor() ServerInterceptor {
+	return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		return m(h)(ctx, call.Service, call.Body)
+	}
+}
+
+// ClientInterceptor defines a function type for intercepting a request on
+// the client side. The interceptor is responsible to call c to complete the
+// method call. The request is passed by value, so an interceptor can modify
+// it before passing it on, e.g. to encrypt the body. The request passed to
+// c by the last interceptor is the one written to the connection. Likewise,
+// an interceptor can modify the response before returning it.
+type ClientInterceptor func(ctx context.Context, req Request, c Caller) (Response, error)
+
+func clientInterceptorChain(interceptors []ClientInterceptor) ClientInterceptor {
+	switch len(interceptors) {
+	case 0:
+		return func(ctx context.Context, req Request, c Caller) (Response, error) {
+			return c.Call(ctx, req)
+		}
+
+	case 1:
+		return interceptors[0]
+
+	default:
+		return func(ctx context.Context, req Request, c Caller) (Response, error) {
+			var next CallerFunc
+
+			idx := 0
+			next = func(ctx context.Context, req Request) (Response, error) {
+				if idx++; idx == len(interceptors) {
+					return c.Call(ctx, req)
+				}
+				return interceptors[idx](ctx, req, next)
+			}
+
+			return interceptors[idx](ctx, req, next)
+		}
+	}
+}
+
+// Respond completes a method call successfully with the given body. It is
+// meant to be returned by interceptors which answer a call without calling
+// the handler, e.g. for serving cached responses:
+//
+//	return mrpc.Respond(body)
+func Respond(body []byte) ([]byte, error) {
+	return body, nil
+}
+
 func serverInterceptorChain(interceptors []ServerInterceptor) ServerInterceptor {
 	switch len(interceptors) {
 	case 0:
@@ -28,17 +120,349 @@ func serverInterceptorChain(interceptors []ServerInterceptor) ServerInterceptor
 
 	default:
 		return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
-			var next Handler
+			st := &chainState{interceptors: interceptors, call: call, h: h}
+			st.next = st.handle
+			return interceptors[0](ctx, call, st.next)
+		}
+	}
+}
 
-			idx := 0
-			next = func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
-				if idx++; idx == len(interceptors) {
-					return h(ctx, call.Service, call.Body)
+// chainState holds the state of a single execution of an interceptor chain.
+// It is allocated per call, so a next function which is called late never
+// affects other calls.
+type chainState struct {
+	interceptors []ServerInterceptor
+	call         CallInfo
+	h            Handler
+	idx          int
+	next         Handler // st.handle, bound once per call
+}
+
+func (st *chainState) handle(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+	st.call.Service, st.call.Body = svc, body
+	if st.idx++; st.idx == len(st.interceptors) {
+		return st.h(ctx, svc, body)
+	}
+	return st.interceptors[st.idx](ctx, st.call, st.next)
+}
+
+// SlowLogInterceptor returns a server interceptor which measures the duration
+// of each method call and calls log for all calls taking longer than the
+// given threshold. The result of the method call is not altered.
+func SlowLogInterceptor(threshold time.Duration, log func(CallInfo, time.Duration)) ServerInterceptor {
+	return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		start := time.Now()
+		resp, err := h(ctx, call.Service, call.Body)
+		if d := time.Since(start); d > threshold {
+			log(call, d)
+		}
+		return resp, err
+	}
+}
+
+// MetricsRecorder defines an interface for recording the outcome of method
+// calls on the server side. The method is identified by the same key which
+// is used in CallInfo.
+type MetricsRecorder interface {
+	RecordCall(method string, code ErrCode, d time.Duration)
+}
+
+// MetricsInterceptor returns a server interceptor which reports the duration
+// and the error code of each method call to r.
+func MetricsInterceptor(r MetricsRecorder) ServerInterceptor {
+	return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		start := time.Now()
+		resp, err := h(ctx, call.Service, call.Body)
+		r.RecordCall(call.Method, ErrorCode(err), time.Since(start))
+		return resp, err
+	}
+}
+
+// ClientRecorder defines an interface for recording the outcome of method
+// calls on the client side. The method is identified as in CallInfo, i.e.
+// the service name and the method id separated by a colon.
+type ClientRecorder interface {
+	RecordCall(method string, code ErrCode, d time.Duration)
+}
+
+// NopClientRecorder is a client recorder which discards all calls.
+type NopClientRecorder struct{}
+
+// RecordCall implements the ClientRecorder interface.
+func (NopClientRecorder) RecordCall(method string, code ErrCode, d time.Duration) {}
+
+// ClientMetricsInterceptor returns a client interceptor which reports the
+// duration and the error code of each method call to r. The duration
+// includes the time for encoding, transmitting and decoding the call. Errors
+// of the call itself, e.g. transport errors, are reported with their error
+// code (see ErrorCode), otherwise the response's error code is reported.
+func ClientMetricsInterceptor(r ClientRecorder) ClientInterceptor {
+	return func(ctx context.Context, req Request, c Caller) (Response, error) {
+		start := time.Now()
+		resp, err := c.Call(ctx, req)
+
+		code := resp.Code()
+		if err != nil {
+			code = ErrorCode(err)
+		}
+		r.RecordCall(methodKey{service: req.Service, id: req.Method}.String(), code, time.Since(start))
+		return resp, err
+	}
+}
+
+// DedupInterceptor returns a server interceptor which rejects requests whose
+// request id was already seen within the given time window. Duplicates are
+// answered with an AlreadyExists error without calling the handler. Requests
+// without a request id are never rejected.
+func DedupInterceptor(window time.Duration) ServerInterceptor {
+	var (
+		mtx  sync.Mutex
+		seen = newDedupWindow(window)
+	)
+
+	return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		if id := call.Headers.RequestID; id != "" {
+			mtx.Lock()
+			dup := !seen.add(id, time.Now())
+			mtx.Unlock()
+			if dup {
+				return nil, Errorf(AlreadyExists, "duplicate request %s", id)
+			}
+		}
+		return h(ctx, call.Service, call.Body)
+	}
+}
+
+type dedupEntry struct {
+	id   string
+	seen time.Time
+}
+
+// dedupWindow holds the request ids seen within a time window. The ids are
+// kept in arrival order, so expired ids can be evicted from the front.
+type dedupWindow struct {
+	window  time.Duration
+	ids     map[string]struct{}
+	entries []dedupEntry
+}
+
+func newDedupWindow(window time.Duration) *dedupWindow {
+	return &dedupWindow{
+		window: window,
+		ids:    make(map[string]struct{}),
+	}
+}
+
+// add adds the given id and reports whether it was not seen before.
+func (w *dedupWindow) add(id string, now time.Time) bool {
+	n := 0
+	for ; n < len(w.entries) && now.Sub(w.entries[n].seen) > w.window; n++ {
+		delete(w.ids, w.entries[n].id)
+	}
+	w.entries = w.entries[n:]
+
+	if _, has := w.ids[id]; has {
+		return false
+	}
+	w.ids[id] = struct{}{}
+	w.entries = append(w.entries, dedupEntry{id: id, seen: now})
+	return true
+}
+
+// CoalesceInterceptor returns a server interceptor which coalesces concurrent
+// calls with the same key, e.g. the method name and a hash of the body. The
+// handler is only executed by the first of these calls, and all other calls
+// wait for its result. Each waiting call gets its own copy of a successful
+// result. Errors are not shared: if the first call fails, the waiting calls
+// execute the handler on their own. Calls with an empty key are never
+// coalesced. The interceptor should only be used for read-only methods.
+func CoalesceInterceptor(key func(CallInfo) string) ServerInterceptor {
+	var (
+		mtx   sync.Mutex
+		calls = make(map[string]*coalescedCall)
+	)
+
+	return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		k := key(call)
+		if k == "" {
+			return h(ctx, call.Service, call.Body)
+		}
+
+		mtx.Lock()
+		if c, has := calls[k]; has {
+			mtx.Unlock()
+			select {
+			case <-c.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if c.err != nil {
+				return h(ctx, call.Service, call.Body)
+			}
+			return append([]byte(nil), c.body...), nil
+		}
+
+		c := &coalescedCall{
+			done: make(chan struct{}),
+			err:  Error(Internal, "coalesced call failed"), // overwritten unless the handler panics
+		}
+		calls[k] = c
+		mtx.Unlock()
+
+		defer func() {
+			mtx.Lock()
+			delete(calls, k)
+			mtx.Unlock()
+			close(c.done)
+		}()
+
+		c.body, c.err = h(ctx, call.Service, call.Body)
+		return c.body, c.err
+	}
+}
+
+type coalescedCall struct {
+	done chan struct{} // closed when body and err are set
+	body []byte
+	err  error
+}
+
+// MaintenanceInterceptor returns a server interceptor which rejects all calls
+// with an Unavailable error while enabled is set. Rejected responses carry
+// the given retry duration in their metadata (see RetryAfterKey). The
+// maintenance mode can be toggled at any time by changing enabled.
+func MaintenanceInterceptor(enabled *atomic.Bool, retryAfter time.Duration) ServerInterceptor {
+	return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		if enabled.Load() {
+			SetResponseMetadata(ctx, RetryAfterKey, retryAfter.String())
+			return nil, Error(Unavailable, "service is under maintenance")
+		}
+		return h(ctx, call.Service, call.Body)
+	}
+}
+
+// MapErrorsInterceptor returns a server interceptor which translates errors
+// returned by the handler into errors with an error code. If the returned
+// error matches one of the errors in m (see errors.Is), the error text is
+// kept and the error code is replaced with the mapped one. If the error
+// matches multiple errors, it is undefined which of the codes is used.
+func MapErrorsInterceptor(m map[error]ErrCode) ServerInterceptor {
+	return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		resp, err := h(ctx, call.Service, call.Body)
+		if err != nil {
+			for target, code := range m {
+				if errors.Is(err, target) {
+					return resp, Error(code, err.Error())
+				}
+			}
+		}
+		return resp, err
+	}
+}
+
+// PanicInfo holds the details of a panic recovered by RecoveryInterceptor.
+type PanicInfo struct {
+	Value interface{} // recovered value
+	Stack []byte      // stack trace of the panicking goroutine
+}
+
+// RecoveryInterceptor returns a server interceptor which recovers from
+// panics in the handler and all subsequent interceptors. If the panic value
+// is an error with an error code (see ErrorCode), the error is returned as
+// is, so that handlers can use
+//
+//	panic(mrpc.Error(mrpc.InvalidArgument, "invalid input"))
+//
+// as a shortcut. All other panics are answered with an Internal error. The
+// stack trace is never sent to the client. If onPanic is not nil, it is
+// called with the recovered value and the stack trace for each panic.
+// Otherwise the panic is logged with the standard logger.
+func RecoveryInterceptor(onPanic func(CallInfo, PanicInfo)) ServerInterceptor {
+	if onPanic == nil {
+		onPanic = func(call CallInfo, p PanicInfo) {
+			log.Printf("mrpc: panic in method %s: %v\n%s", call.Method, p.Value, p.Stack)
+		}
+	}
+
+	return func(ctx context.Context, call CallInfo, h Handler) (resp []byte, err error) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+
+			stack := make([]byte, 64<<10)
+			stack = stack[:runtime.Stack(stack, false)]
+			onPanic(call, PanicInfo{Value: p, Stack: stack})
+
+			resp, err = nil, Error(Internal, "internal server error")
+			if e, ok := p.(error); ok {
+				var coded interface{ ErrorCode() ErrCode }
+				if errors.As(e, &coded) {
+					err = e
 				}
-				return interceptors[idx](ctx, call, next)
 			}
+		}()
+		return h(ctx, call.Service, call.Body)
+	}
+}
+
+// recoverInterceptor wraps the named interceptor, so that its panics are
+// recovered and passed to log. Panics of the following interceptors and the
+// handler are passed through.
+func recoverInterceptor(name string, intercept ServerInterceptor, log func(string, CallInfo, PanicInfo)) ServerInterceptor {
+	return func(ctx context.Context, call CallInfo, h Handler) (resp []byte, err error) {
+		inner := false // whether h is running
+		defer func() {
+			if inner {
+				return
+			}
+			if p := recover(); p != nil {
+				stack := make([]byte, 64<<10)
+				stack = stack[:runtime.Stack(stack, false)]
+				log(name, call, PanicInfo{Value: p, Stack: stack})
+				resp, err = nil, Error(Internal, "internal server error")
+			}
+		}()
+
+		return intercept(ctx, call, func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+			inner = true
+			resp, err := h(ctx, svc, body)
+			inner = false
+			return resp, err
+		})
+	}
+}
 
-			return interceptors[idx](ctx, call, next)
+func logInterceptorPanic(name string, call CallInfo, p PanicInfo) {
+	if name == "" {
+		name = "unnamed"
+	}
+	log.Printf("mrpc: panic in interceptor %s for method %s: %v\n%s", name, call.Method, p.Value, p.Stack)
+}
+
+// SampledLoggingInterceptor returns a server interceptor which logs a
+// fraction of all successful method calls, determined by rate, and all
+// failed method calls. For requests with a request id the sampling decision
+// is derived from the id, so that all services handling a request make the
+// same decision.
+func SampledLoggingInterceptor(rate float64, log func(CallInfo, ErrCode, time.Duration)) ServerInterceptor {
+	return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		start := time.Now()
+		resp, err := h(ctx, call.Service, call.Body)
+		if code := ErrorCode(err); code != OK || sample(call.Headers.RequestID, rate) {
+			log(call, code, time.Since(start))
 		}
+		return resp, err
 	}
 }
+
+func sample(requestID string, rate float64) bool {
+	if requestID == "" {
+		return rand.Float64() < rate
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(requestID))
+	return float64(h.Sum64()>>11)/(1<<53) < rate
+}
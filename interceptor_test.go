@@ -0,0 +1,752 @@
+package mrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInterceptorRespond(t *testing.T) {
+	ctx := context.Background()
+
+	handlerCalled := false
+	s := newServer(t, WithServerInterceptor(func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		return Respond([]byte("static body"))
+	}))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					handlerCalled = true
+					return []byte("handler body"), nil
+				},
+			},
+		},
+	})
+
+	resp := s.Execute(ctx, Request{Service: "my-service", Method: 1})
+	switch {
+	case ResponseError(resp) != nil:
+		t.Fatalf("unexpected error: %v", ResponseError(resp))
+	case handlerCalled:
+		t.Fatal("unexpected handler call")
+	case !bytes.Equal(resp.Body, []byte("static body")):
+		t.Fatalf("unexpected body: %q", resp.Body)
+	}
+}
+
+func TestSlowLogInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	var logged []string
+	s := newServer(t, WithServerInterceptor(SlowLogInterceptor(50*time.Millisecond, func(call CallInfo, d time.Duration) {
+		logged = append(logged, call.Method)
+	})))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return []byte("fast"), nil
+				},
+			},
+			{
+				ID: 2,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					time.Sleep(100 * time.Millisecond)
+					return []byte("slow"), nil
+				},
+			},
+		},
+	})
+
+	for _, m := range []int{1, 2} {
+		resp := s.Execute(ctx, Request{Service: "my-service", Method: m})
+		if err := ResponseError(resp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(logged) != 1 || logged[0] != "my-service:2" {
+		t.Fatalf("unexpected logged calls: %v", logged)
+	}
+}
+
+func TestMetricsInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	rec := &metricsRecorder{}
+	s := newServer(t, WithServerInterceptor(MetricsInterceptor(rec)))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return nil, Error(NotFound, "not found")
+				},
+			},
+		},
+	})
+
+	s.Execute(ctx, Request{Service: "my-service", Method: 1})
+	switch {
+	case len(rec.methods) != 1 || rec.methods[0] != "my-service:1":
+		t.Fatalf("unexpected recorded methods: %v", rec.methods)
+	case len(rec.codes) != 1 || rec.codes[0] != NotFound:
+		t.Fatalf("unexpected recorded codes: %v", rec.codes)
+	}
+}
+
+type metricsRecorder struct {
+	methods []string
+	codes   []ErrCode
+}
+
+func (r *metricsRecorder) RecordCall(method string, code ErrCode, d time.Duration) {
+	r.methods = append(r.methods, method)
+	r.codes = append(r.codes, code)
+}
+
+func TestClientMetricsInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	errBroken := errors.New("broken pipe")
+	caller := CallerFunc(func(ctx context.Context, req Request) (Response, error) {
+		switch req.Method {
+		case 1:
+			return Response{}, nil
+		case 2:
+			return Response{ErrorCode: NotFound}, nil
+		default:
+			return Response{}, errBroken
+		}
+	})
+
+	rec := &metricsRecorder{}
+	intercept := ClientMetricsInterceptor(rec)
+	for method := 1; method <= 3; method++ {
+		intercept(ctx, Request{Service: "my-service", Method: method}, caller)
+	}
+
+	switch {
+	case !reflect.DeepEqual(rec.methods, []string{"my-service:1", "my-service:2", "my-service:3"}):
+		t.Fatalf("unexpected recorded methods: %v", rec.methods)
+	case !reflect.DeepEqual(rec.codes, []ErrCode{OK, NotFound, Unknown}):
+		t.Fatalf("unexpected recorded codes: %v", rec.codes)
+	}
+
+	// The no-op recorder must be usable as is.
+	if _, err := ClientMetricsInterceptor(NopClientRecorder{})(ctx, Request{Method: 1}, caller); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDedupInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	calls := 0
+	s := newServer(t, WithServerInterceptor(DedupInterceptor(time.Minute)))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					calls++
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	req := Request{
+		Service: "my-service",
+		Method:  1,
+		Headers: RequestHeaders{RequestID: "request-id"},
+	}
+
+	if err := ResponseError(s.Execute(ctx, req)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resp := s.Execute(ctx, req)
+	switch {
+	case resp.ErrorCode != AlreadyExists:
+		t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+	case calls != 1:
+		t.Fatalf("unexpected number of handler calls: %d", calls)
+	}
+
+	req.Headers.RequestID = "other-request-id"
+	if err := ResponseError(s.Execute(ctx, req)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if calls != 2 {
+		t.Fatalf("unexpected number of handler calls: %d", calls)
+	}
+}
+
+func TestDedupWindowEviction(t *testing.T) {
+	w := newDedupWindow(time.Second)
+	now := time.Now()
+
+	if !w.add("id", now) {
+		t.Fatal("expected id to be added")
+	}
+	if w.add("id", now.Add(time.Second)) {
+		t.Fatal("expected duplicate within the window")
+	}
+	if !w.add("id", now.Add(2*time.Second)) {
+		t.Fatal("expected id to be evicted after the window")
+	}
+}
+
+func TestCoalesceInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	const n = 10
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+		calls   int32
+	)
+	intercept := CoalesceInterceptor(func(call CallInfo) string {
+		return call.Method + ":" + string(call.Body)
+	})
+	handler := func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+		}
+		<-release
+		return []byte("result"), nil
+	}
+	call := CallInfo{Method: "my-service:1", Body: []byte("body")}
+
+	var wg sync.WaitGroup
+	results := make([][]byte, n)
+	run := func(ctx context.Context, i int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, err := intercept(ctx, call, handler)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			results[i] = body
+		}()
+	}
+
+	// The first call executes the handler, all others wait for its result
+	// before the handler is released.
+	run(ctx, 0)
+	<-started
+	waiting := make(chan struct{}, n)
+	for i := 1; i < n; i++ {
+		run(waitingContext{Context: ctx, waiting: waiting}, i)
+	}
+	for i := 1; i < n; i++ {
+		<-waiting
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("unexpected number of handler calls: %d", calls)
+	}
+	for i, body := range results {
+		if string(body) != "result" {
+			t.Fatalf("unexpected result %d: %q", i, body)
+		}
+	}
+	results[0][0] = 'X'
+	for i, body := range results[1:] {
+		if string(body) != "result" {
+			t.Fatalf("result %d shares memory with another result", i+1)
+		}
+	}
+}
+
+func TestCoalesceInterceptorErrors(t *testing.T) {
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls int32
+	intercept := CoalesceInterceptor(func(call CallInfo) string { return "key" })
+	handler := func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-release
+			return nil, Error(Unavailable, "unavailable")
+		}
+		return []byte("result"), nil
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := intercept(ctx, CallInfo{}, handler)
+		errc <- err
+	}()
+	<-started
+
+	waiting := make(chan struct{}, 1)
+	go func() {
+		<-waiting
+		close(release)
+	}()
+	body, err := intercept(waitingContext{Context: ctx, waiting: waiting}, CallInfo{}, handler)
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case string(body) != "result":
+		t.Fatalf("unexpected result: %q", body)
+	case ErrorCode(<-errc) != Unavailable:
+		t.Fatal("unexpected error of the first call")
+	case calls != 2:
+		t.Fatalf("unexpected number of handler calls: %d", calls)
+	}
+}
+
+// waitingContext signals on waiting when its Done channel is requested,
+// which the coalescing interceptor does when a call starts waiting for the
+// result of another call.
+type waitingContext struct {
+	context.Context
+	waiting chan<- struct{}
+}
+
+func (c waitingContext) Done() <-chan struct{} {
+	select {
+	case c.waiting <- struct{}{}:
+	default:
+	}
+	return c.Context.Done()
+}
+
+func TestMaintenanceInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	var enabled atomic.Bool
+	handlerCalled := false
+	s := newServer(t, WithServerInterceptor(MaintenanceInterceptor(&enabled, time.Minute)))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					handlerCalled = true
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	req := Request{Service: "my-service", Method: 1}
+
+	resp := s.Execute(ctx, req)
+	if err := ResponseError(resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !handlerCalled {
+		t.Fatal("handler not called")
+	}
+
+	enabled.Store(true)
+	handlerCalled = false
+	resp = s.Execute(ctx, req)
+	switch {
+	case resp.ErrorCode != Unavailable:
+		t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+	case resp.Metadata[RetryAfterKey] != "1m0s":
+		t.Fatalf("unexpected metadata: %v", resp.Metadata)
+	case handlerCalled:
+		t.Fatal("unexpected handler call")
+	}
+
+	enabled.Store(false)
+	resp = s.Execute(ctx, req)
+	if err := ResponseError(resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !handlerCalled {
+		t.Fatal("handler not called")
+	}
+}
+
+func TestMapErrorsInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	errNotFound := errors.New("no rows")
+	s := newServer(t, WithServerInterceptor(MapErrorsInterceptor(map[error]ErrCode{
+		errNotFound: NotFound,
+	})))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return nil, fmt.Errorf("find user: %w", errNotFound)
+				},
+			},
+			{
+				ID: 2,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return nil, errors.New("other error")
+				},
+			},
+		},
+	})
+
+	resp := s.Execute(ctx, Request{Service: "my-service", Method: 1})
+	switch {
+	case resp.ErrorCode != NotFound:
+		t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+	case resp.ErrorText != "find user: no rows":
+		t.Fatalf("unexpected error text: %q", resp.ErrorText)
+	}
+
+	resp = s.Execute(ctx, Request{Service: "my-service", Method: 2})
+	if resp.ErrorCode != Unknown {
+		t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+	}
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	var recovered []PanicInfo
+	s := newServer(t, WithServerInterceptor(RecoveryInterceptor(func(call CallInfo, p PanicInfo) {
+		recovered = append(recovered, p)
+	})))
+
+	panicking := func(p interface{}) Handler {
+		return func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+			panic(p)
+		}
+	}
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{ID: 1, Handler: panicking("boom")},
+			{ID: 2, Handler: panicking(errors.New("plain error"))},
+			{ID: 3, Handler: panicking(Error(InvalidArgument, "invalid input"))},
+			{ID: 4, Handler: panicking(fmt.Errorf("wrapped: %w", appError{code: Forbidden}))},
+		},
+	})
+
+	tests := []struct {
+		method int
+		code   ErrCode
+		text   string
+	}{
+		{method: 1, code: Internal, text: "internal server error"},
+		{method: 2, code: Internal, text: "internal server error"},
+		{method: 3, code: InvalidArgument, text: "invalid input"},
+		{method: 4, code: Forbidden, text: "wrapped: application error"},
+	}
+
+	for _, test := range tests {
+		resp := s.Execute(ctx, Request{Service: "my-service", Method: test.method})
+		if resp.ErrorCode != test.code {
+			t.Fatalf("unexpected error code for method %d: %v", test.method, resp.ErrorCode)
+		} else if resp.ErrorText != test.text {
+			t.Fatalf("unexpected error text for method %d: %q", test.method, resp.ErrorText)
+		}
+	}
+
+	if len(recovered) != len(tests) {
+		t.Fatalf("unexpected number of recovered panics: %d", len(recovered))
+	}
+	if p := recovered[0]; p.Value != "boom" {
+		t.Fatalf("unexpected panic value: %v", p.Value)
+	} else if !bytes.Contains(p.Stack, []byte("TestRecoveryInterceptor")) {
+		t.Fatalf("unexpected stack trace: %s", p.Stack)
+	}
+}
+
+func TestRecoveryInterceptorDefaultLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	intercept := RecoveryInterceptor(nil)
+	_, err := intercept(context.Background(), CallInfo{Method: "my-service:1"}, func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		panic("boom")
+	})
+	switch {
+	case ErrorCode(err) != Internal:
+		t.Fatalf("unexpected error: %v", err)
+	case strings.Contains(err.Error(), "goroutine"):
+		t.Fatalf("unexpected stack trace in error text: %s", err)
+	case !strings.Contains(buf.String(), "mrpc: panic in method my-service:1: boom"):
+		t.Fatalf("unexpected log output: %s", buf.String())
+	case !strings.Contains(buf.String(), "goroutine"):
+		t.Fatalf("missing stack trace in log output: %s", buf.String())
+	}
+}
+
+func TestInterceptorRecovery(t *testing.T) {
+	ctx := context.Background()
+
+	var logged []string
+	s := newServer(t,
+		WithInterceptorRecovery(func(name string, call CallInfo, p PanicInfo) {
+			logged = append(logged, fmt.Sprintf("%s %s %v", name, call.Method, p.Value))
+		}),
+		WithServerInterceptor(RecoveryInterceptor(func(call CallInfo, p PanicInfo) {
+			logged = append(logged, fmt.Sprintf("handler %s %v", call.Method, p.Value))
+		})),
+		WithNamedServerInterceptor(NamedInterceptor{
+			Name: "buggy",
+			Interceptor: func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+				if len(call.Body) == 0 {
+					panic("interceptor panic")
+				}
+				return h(ctx, call.Service, call.Body)
+			},
+		}),
+	)
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					panic("handler panic")
+				},
+			},
+		},
+	})
+
+	tests := []struct {
+		body   string
+		logged string
+	}{
+		{body: "", logged: "buggy my-service:1 interceptor panic"},
+		{body: "body", logged: "handler my-service:1 handler panic"},
+	}
+
+	for _, test := range tests {
+		logged = nil
+		resp := s.Execute(ctx, Request{Service: "my-service", Method: 1, Body: []byte(test.body)})
+		if resp.ErrorCode != Internal {
+			t.Fatalf("unexpected error code for body %q: %v", test.body, resp.ErrorCode)
+		} else if !reflect.DeepEqual(logged, []string{test.logged}) {
+			t.Fatalf("unexpected log for body %q: %q", test.body, logged)
+		}
+	}
+}
+
+func TestSampledLoggingInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	var logged []ErrCode
+	s := newServer(t, WithServerInterceptor(SampledLoggingInterceptor(0, func(call CallInfo, code ErrCode, d time.Duration) {
+		logged = append(logged, code)
+	})))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return nil, nil
+				},
+			},
+			{
+				ID: 2,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return nil, Error(Internal, "internal error")
+				},
+			},
+		},
+	})
+
+	for i := 0; i < 10; i++ {
+		s.Execute(ctx, Request{Service: "my-service", Method: 1})
+		s.Execute(ctx, Request{Service: "my-service", Method: 2})
+	}
+
+	if len(logged) != 10 {
+		t.Fatalf("unexpected number of logged calls: %d", len(logged))
+	}
+	for _, code := range logged {
+		if code != Internal {
+			t.Fatalf("unexpected logged error code: %v", code)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if sample(id, 0) {
+			t.Fatalf("unexpected sample for rate 0: %s", id)
+		}
+		if !sample(id, 1) {
+			t.Fatalf("expected sample for rate 1: %s", id)
+		}
+		if sample(id, 0.5) != sample(id, 0.5) {
+			t.Fatalf("non-deterministic sample: %s", id)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+
+	var order []string
+	middleware := func(name string) Middleware {
+		return func(h Handler) Handler {
+			return func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+				order = append(order, name)
+				resp, err := h(ctx, svc, body)
+				return append(resp, name...), err
+			}
+		}
+	}
+
+	s := newServer(t, WithMiddleware(middleware("a"), middleware("b")))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					order = append(order, "handler")
+					return []byte("result-"), nil
+				},
+			},
+		},
+	})
+
+	resp := s.Execute(ctx, Request{Service: "my-service", Method: 1})
+	switch {
+	case ResponseError(resp) != nil:
+		t.Fatalf("unexpected error: %v", ResponseError(resp))
+	case !reflect.DeepEqual(order, []string{"a", "b", "handler"}):
+		t.Fatalf("unexpected order: %v", order)
+	case string(resp.Body) != "result-ba":
+		t.Fatalf("unexpected body: %s", resp.Body)
+	}
+}
+
+func TestServerInterceptorChainAllocs(t *testing.T) {
+	ctx := context.Background()
+
+	chain := serverInterceptorChain([]ServerInterceptor{passInterceptor, passInterceptor, passInterceptor})
+	handler := func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		return body, nil
+	}
+	call := CallInfo{Method: "my-service:1", Body: []byte("body")}
+
+	// The chain state and its next function are allocated once per call,
+	// independent of the number of interceptors.
+	allocs := testing.AllocsPerRun(100, func() {
+		chain(ctx, call, handler)
+	})
+	if allocs > 2 {
+		t.Fatalf("unexpected allocations per call: %v", allocs)
+	}
+}
+
+func TestServerInterceptorChainArguments(t *testing.T) {
+	ctx := context.Background()
+
+	chain := serverInterceptorChain([]ServerInterceptor{
+		func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+			return h(ctx, "svc", append(call.Body, 'a'))
+		},
+		func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+			if call.Service != "svc" {
+				t.Fatalf("unexpected service: %v", call.Service)
+			}
+			return h(ctx, call.Service, append(call.Body, 'b'))
+		},
+	})
+
+	body, err := chain(ctx, CallInfo{Body: []byte("body-")}, func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		return body, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if string(body) != "body-ab" {
+		t.Fatalf("unexpected body: %q", body)
+	}
+}
+
+func TestServerInterceptorChainLateHandlerCall(t *testing.T) {
+	ctx := context.Background()
+
+	var late Handler
+	chain := serverInterceptorChain([]ServerInterceptor{
+		func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+			if string(call.Body) == "first" {
+				late = h // called after this call returned
+				return nil, nil
+			}
+			return h(ctx, call.Service, call.Body)
+		},
+		passInterceptor,
+	})
+
+	var handled []string
+	chain(ctx, CallInfo{Body: []byte("first")}, func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		handled = append(handled, "first handler: "+string(body))
+		return body, nil
+	})
+	body, err := chain(ctx, CallInfo{Body: []byte("second")}, func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		late(ctx, nil, []byte("late"))
+		handled = append(handled, "second handler: "+string(body))
+		return body, nil
+	})
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case string(body) != "second":
+		t.Fatalf("unexpected body: %q", body)
+	case !reflect.DeepEqual(handled, []string{"first handler: late", "second handler: second"}):
+		t.Fatalf("unexpected handler calls: %q", handled)
+	}
+}
+
+func BenchmarkServerInterceptorChain(b *testing.B) {
+	ctx := context.Background()
+
+	chain := serverInterceptorChain([]ServerInterceptor{passInterceptor, passInterceptor, passInterceptor})
+	handler := func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		return body, nil
+	}
+	call := CallInfo{Method: "my-service:1", Body: []byte("body")}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chain(ctx, call, handler)
+	}
+}
+
+func passInterceptor(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+	return h(ctx, call.Service, call.Body)
+}
@@ -0,0 +1,224 @@
+package mrpc
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Request priorities, from lowest to highest. The priority of a request is
+// specified with the Priority header. Requests without a priority have the
+// normal priority. Priorities above PriorityCritical are treated as
+// critical.
+const (
+	PriorityNormal   uint8 = 0
+	PriorityHigh     uint8 = 1
+	PriorityCritical uint8 = 2
+)
+
+// PriorityLimitInterceptor returns a server interceptor which limits the
+// number of concurrently executed method calls to limit. Calls exceeding
+// the limit wait in a queue of the given size until a slot becomes free,
+// where waiting calls with a higher priority are admitted first. Calls of
+// the same priority are admitted in arrival order. If the queue is full,
+// the waiting call with the lowest priority is rejected with a
+// ResourceExhausted error, which may be the arriving call itself.
+//
+// Waiting consumes the call's deadline. A waiting call is dropped with a
+// Timeout error as soon as its effective deadline (see Server.Execute) has
+// passed, so that calls which cannot complete anymore are never admitted.
+//
+// If limit is less than one or queueSize is negative, the function will
+// panic.
+func PriorityLimitInterceptor(limit, queueSize int) ServerInterceptor {
+	if limit < 1 {
+		panic("non-positive concurrency limit")
+	} else if queueSize < 0 {
+		panic("negative queue size")
+	}
+
+	l := newPriorityLimiter(limit, queueSize)
+	return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		if err := l.acquire(ctx, call.Headers.Priority); err != nil {
+			return nil, err
+		}
+		defer l.release()
+		return h(ctx, call.Service, call.Body)
+	}
+}
+
+type priorityWaiter struct {
+	ctx      context.Context
+	priority uint8
+	ready    chan error // receives nil, when the waiter was admitted
+}
+
+type priorityLimiter struct {
+	mtx       sync.Mutex
+	limit     int
+	queueSize int
+	active    int
+	waiting   []*priorityWaiter // in arrival order
+}
+
+func newPriorityLimiter(limit, queueSize int) *priorityLimiter {
+	return &priorityLimiter{
+		limit:     limit,
+		queueSize: queueSize,
+	}
+}
+
+func (l *priorityLimiter) acquire(ctx context.Context, priority uint8) error {
+	if priority > PriorityCritical {
+		priority = PriorityCritical
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mtx.Lock()
+	if l.active < l.limit && len(l.waiting) == 0 {
+		l.active++
+		l.mtx.Unlock()
+		return nil
+	}
+
+	if len(l.waiting) >= l.queueSize {
+		idx := l.lowest()
+		if idx < 0 || l.waiting[idx].priority >= priority {
+			l.mtx.Unlock()
+			return Error(ResourceExhausted, "too many concurrent requests")
+		}
+		l.waiting[idx].ready <- Error(ResourceExhausted, "too many concurrent requests")
+		l.remove(idx)
+	}
+
+	w := &priorityWaiter{
+		ctx:      ctx,
+		priority: priority,
+		ready:    make(chan error, 1),
+	}
+	l.waiting = append(l.waiting, w)
+	l.mtx.Unlock()
+
+	select {
+	case err := <-w.ready:
+		return err
+
+	case <-ctx.Done():
+		l.mtx.Lock()
+		for i := range l.waiting {
+			if l.waiting[i] == w {
+				l.remove(i)
+				l.mtx.Unlock()
+				return ctx.Err()
+			}
+		}
+		l.mtx.Unlock()
+
+		// The waiter was admitted or rejected concurrently.
+		if err := <-w.ready; err != nil {
+			return err
+		}
+		l.release()
+		return ctx.Err()
+	}
+}
+
+func (l *priorityLimiter) release() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	for idx := l.highest(); idx >= 0; idx = l.highest() {
+		w := l.waiting[idx]
+		l.remove(idx)
+
+		// Waiters whose deadline has passed are dropped instead of being
+		// admitted, even if they did not notice it yet.
+		if err := w.ctx.Err(); err != nil {
+			w.ready <- err
+			continue
+		}
+
+		// The slot is handed over to the waiter.
+		w.ready <- nil
+		return
+	}
+	l.active--
+}
+
+// highest returns the index of the first waiter with the highest priority.
+func (l *priorityLimiter) highest() int {
+	idx := -1
+	for i, w := range l.waiting {
+		if idx < 0 || w.priority > l.waiting[idx].priority {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// lowest returns the index of the last waiter with the lowest priority.
+func (l *priorityLimiter) lowest() int {
+	idx := -1
+	for i, w := range l.waiting {
+		if idx < 0 || w.priority <= l.waiting[idx].priority {
+			idx = i
+		}
+	}
+	return idx
+}
+
+func (l *priorityLimiter) remove(idx int) {
+	copy(l.waiting[idx:], l.waiting[idx+1:])
+	l.waiting[len(l.waiting)-1] = nil
+	l.waiting = l.waiting[:len(l.waiting)-1]
+}
+
+// RateLimit specifies the rate limit of a method (see MethodSpec). A method
+// with a rate limit accepts PerSecond calls per second on average and up to
+// Burst calls at once. A burst of 0 is treated as 1.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// rateLimiter is a token bucket which is safe for concurrent use.
+type rateLimiter struct {
+	mtx    sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time // time of the last refill, zero if never refilled
+}
+
+func newRateLimiter(l RateLimit) *rateLimiter {
+	burst := math.Max(float64(l.Burst), 1)
+	return &rateLimiter{
+		rate:   l.PerSecond,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// allow takes a token from the bucket at time now. If the bucket is empty,
+// allow reports false and the duration until the next token is available.
+func (l *rateLimiter) allow(now time.Time) (bool, time.Duration) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if !l.last.IsZero() && now.After(l.last) {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	if l.last.IsZero() || now.After(l.last) {
+		l.last = now
+	}
+
+	if l.tokens < 1 {
+		return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	}
+	l.tokens--
+	return true, 0
+}
@@ -0,0 +1,227 @@
+package mrpc
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPriorityLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("admission-order", func(t *testing.T) {
+		l := newPriorityLimiter(1, 10)
+		if err := l.acquire(ctx, PriorityNormal); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var (
+			mtx      sync.Mutex
+			admitted []string
+			wg       sync.WaitGroup
+			queued   int
+		)
+		enqueue := func(name string, priority uint8) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := l.acquire(ctx, priority); err != nil {
+					t.Errorf("unexpected error: %v", err)
+					return
+				}
+				mtx.Lock()
+				admitted = append(admitted, name)
+				mtx.Unlock()
+				l.release()
+			}()
+			queued++
+			waitForQueue(t, l, queued)
+		}
+
+		enqueue("low-1", PriorityNormal)
+		enqueue("low-2", PriorityNormal)
+		enqueue("high", PriorityHigh)
+
+		l.release()
+		wg.Wait()
+
+		if expected := []string{"high", "low-1", "low-2"}; !reflect.DeepEqual(admitted, expected) {
+			t.Fatalf("unexpected admission order: %v", admitted)
+		}
+	})
+
+	t.Run("shedding", func(t *testing.T) {
+		l := newPriorityLimiter(1, 1)
+		if err := l.acquire(ctx, PriorityNormal); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		shed := make(chan error, 1)
+		go func() { shed <- l.acquire(ctx, PriorityNormal) }()
+		waitForQueue(t, l, 1)
+
+		// A request with the same priority is rejected on a full queue.
+		if err := l.acquire(ctx, PriorityNormal); ErrorCode(err) != ResourceExhausted {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// A request with a higher priority sheds the waiting request.
+		admitted := make(chan error, 1)
+		go func() { admitted <- l.acquire(ctx, PriorityHigh) }()
+		if err := <-shed; ErrorCode(err) != ResourceExhausted {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		waitForQueue(t, l, 1)
+		l.release()
+		if err := <-admitted; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func waitForQueue(t *testing.T, l *priorityLimiter, n int) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		l.mtx.Lock()
+		queued := len(l.waiting)
+		l.mtx.Unlock()
+		if queued == n {
+			return
+		}
+	}
+	t.Fatalf("timeout waiting for %d queued requests", n)
+}
+
+func TestPriorityLimitInterceptorDeadline(t *testing.T) {
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s := newServer(t, WithServerInterceptor(PriorityLimitInterceptor(1, 10)))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					close(started)
+					<-release
+					return nil, nil
+				},
+			},
+			{
+				ID: 2,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					t.Error("unexpected handler call")
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	done := make(chan Response)
+	go func() { done <- s.Execute(ctx, Request{Service: "my-service", Method: 1}) }()
+	<-started
+
+	start := time.Now()
+	resp := s.Execute(ctx, Request{
+		Service: "my-service",
+		Method:  2,
+		Headers: RequestHeaders{Timeout: uint64(20 * time.Millisecond)},
+	})
+	switch {
+	case resp.ErrorCode != Timeout:
+		t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+	case time.Since(start) > time.Second:
+		t.Fatalf("request not dropped at its deadline: %v", time.Since(start))
+	}
+
+	close(release)
+	if err := ResponseError(<-done); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPriorityLimitInterceptorInvalidArguments(t *testing.T) {
+	tests := []struct {
+		limit     int
+		queueSize int
+		msg       string
+	}{
+		{limit: 0, queueSize: 1, msg: "non-positive concurrency limit"},
+		{limit: -1, queueSize: 1, msg: "non-positive concurrency limit"},
+		{limit: 1, queueSize: -1, msg: "negative queue size"},
+	}
+
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if msg := recover(); msg != test.msg {
+					t.Fatalf("unexpected panic message for limit %d and queue size %d: %v", test.limit, test.queueSize, msg)
+				}
+			}()
+			PriorityLimitInterceptor(test.limit, test.queueSize)
+		}()
+	}
+
+	// A limiter without a queue is valid.
+	PriorityLimitInterceptor(1, 0)
+}
+
+func TestPriorityLimiterExpiredWaiter(t *testing.T) {
+	l := newPriorityLimiter(1, 10)
+	if err := l.acquire(context.Background(), PriorityNormal); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// An expired waiter is never admitted, even if a slot becomes free
+	// before it noticed the expiration.
+	ctx, cancel := context.WithCancel(context.Background())
+	l.mtx.Lock()
+	w := &priorityWaiter{ctx: ctx, ready: make(chan error, 1)}
+	l.waiting = append(l.waiting, w)
+	l.mtx.Unlock()
+
+	cancel()
+	l.release()
+	if err := <-w.ready; err != context.Canceled {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if l.active != 0 {
+		t.Fatalf("unexpected number of active calls: %d", l.active)
+	}
+}
+
+func TestRateLimiterConcurrent(t *testing.T) {
+	now := time.Now()
+	l := newRateLimiter(RateLimit{PerSecond: 1, Burst: 10})
+
+	var (
+		wg      sync.WaitGroup
+		mtx     sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := l.allow(now); ok {
+				mtx.Lock()
+				allowed++
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 10 {
+		t.Fatalf("unexpected number of allowed calls: %d", allowed)
+	}
+	if ok, retryAfter := l.allow(now); ok || retryAfter != time.Second {
+		t.Fatalf("unexpected result for empty bucket: %v, %v", ok, retryAfter)
+	}
+}
@@ -0,0 +1,92 @@
+package mrpc
+
+import (
+	"context"
+	"sync"
+)
+
+// Well-known response metadata keys.
+const (
+	// RetryAfterKey holds the duration after which a client may retry a
+	// rejected call. The value is formatted with time.Duration.String.
+	RetryAfterKey = "retry-after"
+
+	// DeprecatedKey holds a deprecation warning for calls of deprecated
+	// methods. Clients should log the warning.
+	DeprecatedKey = "deprecated"
+)
+
+// Well-known request metadata keys.
+const (
+	// VariantKey holds the name of the method variant which should handle
+	// the request (see MethodSpec).
+	VariantKey = "variant"
+)
+
+// SetResponseMetadata sets a metadata value for the response of the method
+// call associated with ctx. It can be used by handlers and interceptors to
+// pass additional information to the client, regardless of whether the call
+// succeeds or fails. If ctx does not belong to a call executed by a Server,
+// the value is discarded.
+func SetResponseMetadata(ctx context.Context, key, value string) {
+	if info, ok := ctx.Value(responseInfoKey{}).(*responseInfo); ok {
+		info.setMetadata(key, value)
+	}
+}
+
+// AddResponseWarning adds a warning to the response of the method call
+// associated with ctx. Warnings report non-fatal problems of successful
+// calls, e.g. partial results of an aggregation where some backends failed.
+// They do not turn the response into an error response (see
+// Response.Warnings). If ctx does not belong to a call executed by a
+// Server, the warning is discarded.
+func AddResponseWarning(ctx context.Context, warning string) {
+	if info, ok := ctx.Value(responseInfoKey{}).(*responseInfo); ok {
+		info.addWarning(warning)
+	}
+}
+
+type responseInfoKey struct{}
+
+// responseInfo collects the response data which is set during a method call
+// and is not part of the handler's result. It also holds the call's values,
+// the name of the executing server and the body encoding of the request, to
+// share the allocation.
+type responseInfo struct {
+	mtx      sync.Mutex
+	metadata map[string]string
+	warnings []string
+	values   Values
+	server   string
+	encoding string
+}
+
+func withResponseInfo(ctx context.Context, server, encoding string) (context.Context, *responseInfo) {
+	info := &responseInfo{server: server, encoding: encoding}
+	return context.WithValue(ctx, responseInfoKey{}, info), info
+}
+
+func (i *responseInfo) setMetadata(key, value string) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	if i.metadata == nil {
+		i.metadata = make(map[string]string)
+	}
+	i.metadata[key] = value
+}
+
+func (i *responseInfo) addWarning(warning string) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	i.warnings = append(i.warnings, warning)
+}
+
+func (i *responseInfo) apply(resp *Response) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	resp.Metadata = i.metadata
+	resp.Warnings = i.warnings
+}
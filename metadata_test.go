@@ -0,0 +1,58 @@
+package mrpc
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/mprot/msgpack-go"
+)
+
+func TestAddResponseWarning(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t)
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					AddResponseWarning(ctx, "backend a unavailable")
+					AddResponseWarning(ctx, "backend b timed out")
+					return []byte("partial result"), nil
+				},
+			},
+		},
+	})
+
+	var req, out bytes.Buffer
+	if err := msgpack.Encode(&req, &Request{Service: "my-service", Method: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.ServeMRPC(ctx, &req, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp Response
+	if err := msgpack.Decode(&out, &resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	switch {
+	case ResponseError(resp) != nil:
+		t.Fatalf("unexpected error: %v", ResponseError(resp))
+	case string(resp.Body) != "partial result":
+		t.Fatalf("unexpected body: %s", resp.Body)
+	case !reflect.DeepEqual(resp.Warnings, []string{"backend a unavailable", "backend b timed out"}):
+		t.Fatalf("unexpected warnings: %q", resp.Warnings)
+	}
+
+	// Warnings are discarded outside of a method call and do not show up in
+	// the responses of later calls.
+	AddResponseWarning(ctx, "warning")
+	resp = s.Execute(ctx, Request{Service: "my-service", Method: 1})
+	if !reflect.DeepEqual(resp.Warnings, []string{"backend a unavailable", "backend b timed out"}) {
+		t.Fatalf("unexpected warnings: %q", resp.Warnings)
+	}
+}
@@ -19,16 +19,20 @@ type ErrCode int
 
 // Enumerators for ErrCode.
 const (
-	OK              ErrCode = 0
-	Unknown         ErrCode = 1
-	Timeout         ErrCode = 2
-	NotFound        ErrCode = 3
-	AlreadyExists   ErrCode = 4
-	InvalidArgument ErrCode = 5
-	Unauthorized    ErrCode = 6
-	Forbidden       ErrCode = 7
-	Internal        ErrCode = 8
-	Unavailable     ErrCode = 9
+	OK                 ErrCode = 0
+	Unknown            ErrCode = 1
+	Timeout            ErrCode = 2
+	NotFound           ErrCode = 3
+	AlreadyExists      ErrCode = 4
+	InvalidArgument    ErrCode = 5
+	Unauthorized       ErrCode = 6
+	Forbidden          ErrCode = 7
+	Internal           ErrCode = 8
+	Unavailable        ErrCode = 9
+	ResourceExhausted  ErrCode = 10
+	Canceled           ErrCode = 11
+	DataLoss           ErrCode = 12
+	FailedPrecondition ErrCode = 13
 )
 
 // EncodeMsgpack implements the Encoder interface for ErrCode.
@@ -48,12 +52,20 @@ func (o *ErrCode) DecodeMsgpack(r *msgpack.Reader) error {
 
 // RequestHeaders holds all supported header data for a mrpc request.
 type RequestHeaders struct {
-	Timeout uint64
+	Timeout       uint64
+	RequestID     string
+	Hops          uint8
+	MethodVersion int
+	Checksum      uint64
+	Priority      uint8
+	Version       uint8
+	Metadata      map[string]string
+	BodyEncoding  string
 }
 
 // EncodeMsgpack implements the Encoder interface for RequestHeaders.
 func (o *RequestHeaders) EncodeMsgpack(w *msgpack.Writer) (err error) {
-	if err = w.WriteMapHeader(1); err != nil {
+	if err = w.WriteMapHeader(9); err != nil {
 		return err
 	}
 	// Timeout
@@ -63,6 +75,70 @@ func (o *RequestHeaders) EncodeMsgpack(w *msgpack.Writer) (err error) {
 	if err = w.WriteUint64(o.Timeout); err != nil {
 		return err
 	}
+	// RequestID
+	if err = w.WriteInt64(2); err != nil {
+		return err
+	}
+	if err = w.WriteString(o.RequestID); err != nil {
+		return err
+	}
+	// Hops
+	if err = w.WriteInt64(3); err != nil {
+		return err
+	}
+	if err = w.WriteUint8(o.Hops); err != nil {
+		return err
+	}
+	// MethodVersion
+	if err = w.WriteInt64(4); err != nil {
+		return err
+	}
+	if err = w.WriteInt(o.MethodVersion); err != nil {
+		return err
+	}
+	// Checksum
+	if err = w.WriteInt64(5); err != nil {
+		return err
+	}
+	if err = w.WriteUint64(o.Checksum); err != nil {
+		return err
+	}
+	// Priority
+	if err = w.WriteInt64(6); err != nil {
+		return err
+	}
+	if err = w.WriteUint8(o.Priority); err != nil {
+		return err
+	}
+	// Version
+	if err = w.WriteInt64(7); err != nil {
+		return err
+	}
+	if err = w.WriteUint8(o.Version); err != nil {
+		return err
+	}
+	// Metadata
+	if err = w.WriteInt64(8); err != nil {
+		return err
+	}
+	if err = w.WriteMapHeader(len(o.Metadata)); err != nil {
+		return err
+	}
+	for k, v := range o.Metadata {
+		if err = w.WriteString(k); err != nil {
+			return err
+		}
+		if err = w.WriteString(v); err != nil {
+			return err
+		}
+	}
+	// BodyEncoding
+	if err = w.WriteInt64(9); err != nil {
+		return err
+	}
+	if err = w.WriteString(o.BodyEncoding); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -82,6 +158,52 @@ func (o *RequestHeaders) DecodeMsgpack(r *msgpack.Reader) error {
 			if o.Timeout, err = r.ReadUint64(); err != nil {
 				return err
 			}
+		case 2: // RequestID
+			if o.RequestID, err = r.ReadString(); err != nil {
+				return err
+			}
+		case 3: // Hops
+			if o.Hops, err = r.ReadUint8(); err != nil {
+				return err
+			}
+		case 4: // MethodVersion
+			if o.MethodVersion, err = r.ReadInt(); err != nil {
+				return err
+			}
+		case 5: // Checksum
+			if o.Checksum, err = r.ReadUint64(); err != nil {
+				return err
+			}
+		case 6: // Priority
+			if o.Priority, err = r.ReadUint8(); err != nil {
+				return err
+			}
+		case 7: // Version
+			if o.Version, err = r.ReadUint8(); err != nil {
+				return err
+			}
+		case 8: // Metadata
+			m, err := r.ReadMapHeader()
+			if err != nil {
+				return err
+			}
+			o.Metadata = nil
+			if m > 0 {
+				o.Metadata = make(map[string]string)
+			}
+			for j := 0; j < m; j++ {
+				k, err := r.ReadString()
+				if err != nil {
+					return err
+				}
+				if o.Metadata[k], err = r.ReadString(); err != nil {
+					return err
+				}
+			}
+		case 9: // BodyEncoding
+			if o.BodyEncoding, err = r.ReadString(); err != nil {
+				return err
+			}
 		default:
 			if err := r.Skip(); err != nil {
 				return err
@@ -178,16 +300,22 @@ func (o *Request) DecodeMsgpack(r *msgpack.Reader) error {
 // Response holds the data for an mrpc response. If ErrCode is not OK, an
 // error with the specified error text will be reported to the client. In
 // this case the return value will be ignored. In case of a successful call,
-// the return value will be reported to the client.
+// the return value will be reported to the client. Warnings report
+// non-fatal problems and do not indicate an error. Details hold the error
+// texts of the individual errors of an aggregated error (see MultiError).
 type Response struct {
 	ErrorCode ErrCode
 	ErrorText string
 	Body      []byte
+	Metadata  map[string]string
+	RequestID string
+	Warnings  []string
+	Details   []string
 }
 
 // EncodeMsgpack implements the Encoder interface for Response.
 func (o *Response) EncodeMsgpack(w *msgpack.Writer) (err error) {
-	if err = w.WriteMapHeader(3); err != nil {
+	if err = w.WriteMapHeader(7); err != nil {
 		return err
 	}
 	// ErrorCode
@@ -211,6 +339,52 @@ func (o *Response) EncodeMsgpack(w *msgpack.Writer) (err error) {
 	if err = w.WriteBytes(o.Body); err != nil {
 		return err
 	}
+	// Metadata
+	if err = w.WriteInt64(4); err != nil {
+		return err
+	}
+	if err = w.WriteMapHeader(len(o.Metadata)); err != nil {
+		return err
+	}
+	for k, v := range o.Metadata {
+		if err = w.WriteString(k); err != nil {
+			return err
+		}
+		if err = w.WriteString(v); err != nil {
+			return err
+		}
+	}
+	// RequestID
+	if err = w.WriteInt64(5); err != nil {
+		return err
+	}
+	if err = w.WriteString(o.RequestID); err != nil {
+		return err
+	}
+	// Warnings
+	if err = w.WriteInt64(6); err != nil {
+		return err
+	}
+	if err = w.WriteArrayHeader(len(o.Warnings)); err != nil {
+		return err
+	}
+	for _, v := range o.Warnings {
+		if err = w.WriteString(v); err != nil {
+			return err
+		}
+	}
+	// Details
+	if err = w.WriteInt64(7); err != nil {
+		return err
+	}
+	if err = w.WriteArrayHeader(len(o.Details)); err != nil {
+		return err
+	}
+	for _, v := range o.Details {
+		if err = w.WriteString(v); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -238,6 +412,54 @@ func (o *Response) DecodeMsgpack(r *msgpack.Reader) error {
 			if o.Body, err = r.ReadBytes(nil); err != nil {
 				return err
 			}
+		case 4: // Metadata
+			m, err := r.ReadMapHeader()
+			if err != nil {
+				return err
+			}
+			o.Metadata = nil
+			if m > 0 {
+				o.Metadata = make(map[string]string)
+			}
+			for j := 0; j < m; j++ {
+				k, err := r.ReadString()
+				if err != nil {
+					return err
+				}
+				if o.Metadata[k], err = r.ReadString(); err != nil {
+					return err
+				}
+			}
+		case 5: // RequestID
+			if o.RequestID, err = r.ReadString(); err != nil {
+				return err
+			}
+		case 6: // Warnings
+			m, err := r.ReadArrayHeader()
+			if err != nil {
+				return err
+			}
+			o.Warnings = nil
+			for j := 0; j < m; j++ {
+				v, err := r.ReadString()
+				if err != nil {
+					return err
+				}
+				o.Warnings = append(o.Warnings, v)
+			}
+		case 7: // Details
+			m, err := r.ReadArrayHeader()
+			if err != nil {
+				return err
+			}
+			o.Details = nil
+			for j := 0; j < m; j++ {
+				v, err := r.ReadString()
+				if err != nil {
+					return err
+				}
+				o.Details = append(o.Details, v)
+			}
 		default:
 			if err := r.Skip(); err != nil {
 				return err
@@ -0,0 +1,273 @@
+package mrpc
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/mprot/msgpack-go"
+)
+
+// The generated codecs skip unknown fields and leave missing fields at
+// their zero values, so that peers with different versions of the schema
+// can talk to each other. The tests simulate such peers with the types
+// below, which encode and decode the request with fewer or more fields.
+
+func TestRequestSchemaEvolution(t *testing.T) {
+	t.Run("older-client", func(t *testing.T) {
+		old := oldRequest{Service: "my-service", Method: 1, Timeout: 100, RequestID: "id", Body: []byte("body")}
+
+		var req Request
+		roundTrip(t, &old, &req)
+
+		expected := Request{
+			Service: "my-service",
+			Method:  1,
+			Headers: RequestHeaders{Timeout: 100, RequestID: "id"},
+			Body:    []byte("body"),
+		}
+		if !reflect.DeepEqual(req, expected) {
+			t.Fatalf("unexpected request: %#v", req)
+		}
+	})
+
+	t.Run("newer-client", func(t *testing.T) {
+		newer := newerRequest{
+			Request: Request{
+				Service: "my-service",
+				Method:  1,
+				Headers: RequestHeaders{Timeout: 100, RequestID: "id"},
+				Body:    []byte("body"),
+			},
+			TraceID: "trace-id",
+			Tags:    []string{"a", "b"},
+		}
+
+		var req Request
+		roundTrip(t, &newer, &req)
+		if !reflect.DeepEqual(req, newer.Request) {
+			t.Fatalf("unexpected request: %#v", req)
+		}
+
+		var old oldRequest
+		roundTrip(t, &newer, &old)
+		expected := oldRequest{Service: "my-service", Method: 1, Timeout: 100, RequestID: "id", Body: []byte("body")}
+		if !reflect.DeepEqual(old, expected) {
+			t.Fatalf("unexpected request: %#v", old)
+		}
+	})
+
+	t.Run("older-server", func(t *testing.T) {
+		req := Request{
+			Service: "my-service",
+			Method:  1,
+			Headers: RequestHeaders{Timeout: 100, RequestID: "id", Hops: 2, MethodVersion: 3, Priority: PriorityHigh, Version: ProtocolVersion},
+			Body:    []byte("body"),
+		}
+
+		var old oldRequest
+		roundTrip(t, &req, &old)
+		expected := oldRequest{Service: "my-service", Method: 1, Timeout: 100, RequestID: "id", Body: []byte("body")}
+		if !reflect.DeepEqual(old, expected) {
+			t.Fatalf("unexpected request: %#v", old)
+		}
+	})
+}
+
+func roundTrip(t *testing.T, from msgpack.Encoder, to msgpack.Decoder) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := msgpack.Encode(&buf, from); err != nil {
+		t.Fatalf("unexpected encode error: %v", err)
+	}
+	if err := msgpack.Decode(&buf, to); err != nil {
+		t.Fatalf("unexpected decode error: %v", err)
+	}
+}
+
+// oldRequest is a request of an older schema version with only the
+// timeout and request id headers.
+type oldRequest struct {
+	Service   string
+	Method    int
+	Timeout   uint64
+	RequestID string
+	Body      []byte
+}
+
+func (o *oldRequest) EncodeMsgpack(w *msgpack.Writer) (err error) {
+	if err = w.WriteMapHeader(4); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(1); err != nil {
+		return err
+	}
+	if err = w.WriteString(o.Service); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(2); err != nil {
+		return err
+	}
+	if err = w.WriteInt(o.Method); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(3); err != nil {
+		return err
+	}
+	if err = w.WriteMapHeader(2); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(1); err != nil {
+		return err
+	}
+	if err = w.WriteUint64(o.Timeout); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(2); err != nil {
+		return err
+	}
+	if err = w.WriteString(o.RequestID); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(4); err != nil {
+		return err
+	}
+	return w.WriteBytes(o.Body)
+}
+
+func (o *oldRequest) DecodeMsgpack(r *msgpack.Reader) error {
+	return decodeFields(r, func(ord int64) (err error) {
+		switch ord {
+		case 1:
+			o.Service, err = r.ReadString()
+		case 2:
+			o.Method, err = r.ReadInt()
+		case 3:
+			err = decodeFields(r, func(ord int64) (err error) {
+				switch ord {
+				case 1:
+					o.Timeout, err = r.ReadUint64()
+				case 2:
+					o.RequestID, err = r.ReadString()
+				default:
+					err = r.Skip()
+				}
+				return err
+			})
+		case 4:
+			o.Body, err = r.ReadBytes(nil)
+		default:
+			err = r.Skip()
+		}
+		return err
+	})
+}
+
+// newerRequest is a request of a newer schema version with an additional
+// header and an additional request field.
+type newerRequest struct {
+	Request
+	TraceID string   // header 100
+	Tags    []string // request field 100
+}
+
+func (o *newerRequest) EncodeMsgpack(w *msgpack.Writer) (err error) {
+	if err = w.WriteMapHeader(5); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(1); err != nil {
+		return err
+	}
+	if err = w.WriteString(o.Service); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(2); err != nil {
+		return err
+	}
+	if err = w.WriteInt(o.Method); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(3); err != nil {
+		return err
+	}
+	if err = w.WriteMapHeader(3); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(1); err != nil {
+		return err
+	}
+	if err = w.WriteUint64(o.Headers.Timeout); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(100); err != nil {
+		return err
+	}
+	if err = w.WriteString(o.TraceID); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(2); err != nil {
+		return err
+	}
+	if err = w.WriteString(o.Headers.RequestID); err != nil {
+		return err
+	}
+	if err = w.WriteInt64(100); err != nil {
+		return err
+	}
+	if err = w.WriteArrayHeader(len(o.Tags)); err != nil {
+		return err
+	}
+	for _, tag := range o.Tags {
+		if err = w.WriteString(tag); err != nil {
+			return err
+		}
+	}
+	if err = w.WriteInt64(4); err != nil {
+		return err
+	}
+	return w.WriteBytes(o.Body)
+}
+
+func decodeFields(r *msgpack.Reader, decode func(ord int64) error) error {
+	n, err := r.ReadMapHeader()
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		ord, err := r.ReadInt64()
+		if err != nil {
+			return err
+		}
+		if err := decode(ord); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestDecodeForgedLengths(t *testing.T) {
+	// Each field announces 2^32-1 elements without providing them. The
+	// decoding must fail instead of allocating memory for all elements.
+	tests := map[string]struct {
+		ord    int64
+		header byte
+	}{
+		"metadata": {ord: 4, header: 0xdf},
+		"warnings": {ord: 6, header: 0xdd},
+		"details":  {ord: 7, header: 0xdd},
+	}
+
+	for name, test := range tests {
+		var buf bytes.Buffer
+		w := msgpack.NewWriter(&buf)
+		w.WriteMapHeader(1)
+		w.WriteInt64(test.ord)
+		buf.Write([]byte{test.header, 0xff, 0xff, 0xff, 0xff})
+
+		var resp Response
+		if err := msgpack.Decode(&buf, &resp); err == nil {
+			t.Fatalf("expected error for forged %s length", name)
+		}
+	}
+}
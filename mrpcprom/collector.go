@@ -0,0 +1,62 @@
+// Package mrpcprom exposes mrpc server metrics as Prometheus metrics. It is
+// kept separate from the mrpc package, so that the Prometheus client is only
+// required when metrics are actually exported.
+package mrpcprom
+
+import (
+	"strconv"
+	"time"
+
+	mrpc "github.com/mprot/mrpc-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	_ mrpc.MetricsRecorder = (*Collector)(nil)
+	_ prometheus.Collector = (*Collector)(nil)
+)
+
+// Collector records mrpc method calls and exposes them as a request duration
+// histogram labeled by method and a call counter labeled by method and error
+// code. A Collector can be passed to mrpc.MetricsInterceptor and registered
+// at a Prometheus registry.
+type Collector struct {
+	duration *prometheus.HistogramVec
+	calls    *prometheus.CounterVec
+}
+
+// NewCollector creates a new collector. All metric names are prefixed with
+// the given namespace.
+func NewCollector(namespace string) *Collector {
+	return &Collector{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "mrpc_request_duration_seconds",
+			Help:      "Duration of mrpc method calls in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "mrpc_requests_total",
+			Help:      "Number of mrpc method calls by error code.",
+		}, []string{"method", "code"}),
+	}
+}
+
+// RecordCall implements the mrpc.MetricsRecorder interface.
+func (c *Collector) RecordCall(method string, code mrpc.ErrCode, d time.Duration) {
+	c.duration.WithLabelValues(method).Observe(d.Seconds())
+	c.calls.WithLabelValues(method, strconv.Itoa(int(code))).Inc()
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.duration.Describe(ch)
+	c.calls.Describe(ch)
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.duration.Collect(ch)
+	c.calls.Collect(ch)
+}
@@ -0,0 +1,72 @@
+package mrpcprom
+
+import (
+	"testing"
+	"time"
+
+	mrpc "github.com/mprot/mrpc-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollectorRecordCall(t *testing.T) {
+	c := NewCollector("test")
+	c.RecordCall("my-service:1", mrpc.OK, 100*time.Millisecond)
+	c.RecordCall("my-service:1", mrpc.OK, 300*time.Millisecond)
+	c.RecordCall("my-service:1", mrpc.NotFound, 200*time.Millisecond)
+	c.RecordCall("my-service:2", mrpc.Internal, time.Second)
+
+	counts := []struct {
+		method string
+		code   string
+		count  float64
+	}{
+		{method: "my-service:1", code: "0", count: 2},
+		{method: "my-service:1", code: "3", count: 1},
+		{method: "my-service:2", code: "8", count: 1},
+	}
+	for _, test := range counts {
+		if count := testutil.ToFloat64(c.calls.WithLabelValues(test.method, test.code)); count != test.count {
+			t.Fatalf("unexpected call count for %s with code %s: %v", test.method, test.code, count)
+		}
+	}
+
+	reg := prometheus.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatalf("unexpected register error: %v", err)
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("unexpected gather error: %v", err)
+	}
+
+	durations := map[string]struct {
+		count uint64
+		sum   float64
+	}{
+		"my-service:1": {count: 3, sum: 0.6},
+		"my-service:2": {count: 1, sum: 1},
+	}
+	found := 0
+	for _, family := range families {
+		if family.GetName() != "test_mrpc_request_duration_seconds" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			method := m.GetLabel()[0].GetValue()
+			expected, has := durations[method]
+			switch {
+			case !has:
+				t.Fatalf("unexpected method: %s", method)
+			case m.GetHistogram().GetSampleCount() != expected.count:
+				t.Fatalf("unexpected sample count for %s: %d", method, m.GetHistogram().GetSampleCount())
+			case m.GetHistogram().GetSampleSum() < expected.sum-1e-9 || m.GetHistogram().GetSampleSum() > expected.sum+1e-9:
+				t.Fatalf("unexpected sample sum for %s: %v", method, m.GetHistogram().GetSampleSum())
+			}
+			found++
+		}
+	}
+	if found != len(durations) {
+		t.Fatalf("unexpected number of duration histograms: %d", found)
+	}
+}
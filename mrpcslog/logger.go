@@ -0,0 +1,98 @@
+// Package mrpcslog provides request-scoped structured logging for mrpc
+// servers based on log/slog. It is kept separate from the mrpc package, so
+// that the mrpc package does not depend on log/slog.
+package mrpcslog
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+
+	mrpc "github.com/mprot/mrpc-go"
+)
+
+type loggerKey struct{}
+
+// redacted replaces the values of redacted metadata keys.
+const redacted = "***"
+
+// Option represents an option which can be used to configure
+// LoggerInterceptor.
+type Option func(*options)
+
+type options struct {
+	redacted map[string]struct{}
+}
+
+// WithRedactedKeys redacts the values of the given request metadata keys,
+// e.g. for authentication tokens. The keys of redacted values are still
+// logged, but their values are replaced with "***".
+func WithRedactedKeys(keys ...string) Option {
+	return func(o *options) {
+		if o.redacted == nil {
+			o.redacted = make(map[string]struct{}, len(keys))
+		}
+		for _, key := range keys {
+			o.redacted[key] = struct{}{}
+		}
+	}
+}
+
+// LoggerInterceptor returns a server interceptor which derives a logger from
+// base for each method call and stores it in the call's context, where it
+// can be retrieved with LoggerFromContext. The derived logger carries the
+// method name and, if set, the request id and the request metadata of the
+// call. The metadata is logged as a group named "metadata", see
+// WithRedactedKeys for hiding sensitive values. If base is nil, the default
+// logger is used.
+func LoggerInterceptor(base *slog.Logger, opts ...Option) mrpc.ServerInterceptor {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return func(ctx context.Context, call mrpc.CallInfo, h mrpc.Handler) ([]byte, error) {
+		logger := base
+		if logger == nil {
+			logger = slog.Default()
+		}
+
+		logger = logger.With(slog.String("method", call.Method))
+		if call.Headers.RequestID != "" {
+			logger = logger.With(slog.String("request_id", call.Headers.RequestID))
+		}
+		if len(call.Headers.Metadata) != 0 {
+			logger = logger.With(o.metadata(call.Headers.Metadata))
+		}
+
+		ctx = context.WithValue(ctx, loggerKey{}, logger)
+		return h(ctx, call.Service, call.Body)
+	}
+}
+
+func (o *options) metadata(md map[string]string) slog.Attr {
+	keys := make([]string, 0, len(md))
+	for key := range md {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		value := md[key]
+		if _, has := o.redacted[key]; has {
+			value = redacted
+		}
+		attrs = append(attrs, slog.String(key, value))
+	}
+	return slog.Group("metadata", attrs...)
+}
+
+// LoggerFromContext returns the logger stored in ctx by LoggerInterceptor.
+// If ctx holds no logger, the default logger is returned.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
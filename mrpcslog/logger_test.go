@@ -0,0 +1,89 @@
+package mrpcslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"testing"
+
+	mrpc "github.com/mprot/mrpc-go"
+)
+
+func TestLoggerInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	intercept := LoggerInterceptor(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	call := mrpc.CallInfo{
+		Method:  "my-service:1",
+		Headers: mrpc.RequestHeaders{RequestID: "request-id"},
+	}
+	_, err := intercept(ctx, call, func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		LoggerFromContext(ctx).Info("handled")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("unexpected log output %q: %v", buf.String(), err)
+	}
+	switch {
+	case record["msg"] != "handled":
+		t.Fatalf("unexpected message: %v", record["msg"])
+	case record["method"] != "my-service:1":
+		t.Fatalf("unexpected method: %v", record["method"])
+	case record["request_id"] != "request-id":
+		t.Fatalf("unexpected request id: %v", record["request_id"])
+	}
+}
+
+func TestLoggerFromContextDefault(t *testing.T) {
+	if logger := LoggerFromContext(context.Background()); logger != slog.Default() {
+		t.Fatalf("unexpected logger: %v", logger)
+	}
+}
+
+func TestLoggerInterceptorRedactedKeys(t *testing.T) {
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	intercept := LoggerInterceptor(slog.New(slog.NewJSONHandler(&buf, nil)), WithRedactedKeys("authorization"))
+
+	call := mrpc.CallInfo{
+		Method: "my-service:1",
+		Headers: mrpc.RequestHeaders{
+			Metadata: map[string]string{
+				"authorization": "secret-token",
+				"tenant":        "acme",
+			},
+		},
+	}
+	_, err := intercept(ctx, call, func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		LoggerFromContext(ctx).Info("handled")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if bytes.Contains(buf.Bytes(), []byte("secret-token")) {
+		t.Fatalf("redacted value logged: %s", buf.Bytes())
+	}
+
+	var record struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("unexpected log output %q: %v", buf.String(), err)
+	}
+	expected := map[string]string{"authorization": "***", "tenant": "acme"}
+	if !reflect.DeepEqual(record.Metadata, expected) {
+		t.Fatalf("unexpected metadata: %v", record.Metadata)
+	}
+}
@@ -1,15 +1,39 @@
 package mrpc
 
+import (
+	"time"
+)
+
 // ServerOption represents an option which can be used to configure
 // an mrpc server.
 type ServerOption func(*serverOptions) error
 
+type watchdog struct {
+	grace time.Duration
+	log   func(CallInfo)
+}
+
 type serverOptions struct {
+	name         string
+	idempotent   bool
 	interceptors []ServerInterceptor
+	names        []string // interceptor names, empty for unnamed interceptors
+	transports   []TransportInterceptor
+	notFound     Handler
+	watchdog     *watchdog
+	maxErrorText int
+	maxHeader    int
+	versions     *versionRange
+	stats        bool
+	recoverPanic func(string, CallInfo, PanicInfo) // interceptor panic log, nil if disabled
+	resolve      func(string) string
+	clock        clock
 }
 
 func defaultServerOptions() serverOptions {
-	return serverOptions{}
+	return serverOptions{
+		clock: realClock{},
+	}
 }
 
 func (o *serverOptions) apply(opts []ServerOption) error {
@@ -21,11 +45,252 @@ func (o *serverOptions) apply(opts []ServerOption) error {
 	return nil
 }
 
+// WithServerName sets the name of the server, e.g. to identify the server
+// instance in logs. Handlers and interceptors can retrieve the name with
+// ServerNameFromContext. By default, the name is empty.
+func WithServerName(name string) ServerOption {
+	return func(o *serverOptions) error {
+		o.name = name
+		return nil
+	}
+}
+
+// WithIdempotentRegister makes the registration of a service which is
+// identical to an already registered service a no-op instead of a failure,
+// e.g. for plugins which are initialized twice. Two service specifications
+// are identical, if their names and services are equal and their methods
+// have the same ids, aliases, versions, deprecations and rate limits, in
+// the same order. Handlers, variants and variant selectors are only
+// identical if they are the same top-level function. Closures and method
+// values, including handlers wrapped by a ServiceBuilder, are never
+// identical, because they may capture different state. Services which are
+// not comparable (see reflect.Type.Comparable) are never identical. Registering a different
+// service under an existing name still fails.
+func WithIdempotentRegister() ServerOption {
+	return func(o *serverOptions) error {
+		o.idempotent = true
+		return nil
+	}
+}
+
 // WithServerInterceptor adds an interceptor for method calls on the
 // server side. It is possible to add multiple interceptors. In thas
 // case they are executed in the order they are provided.
 func WithServerInterceptor(interceptor ServerInterceptor) ServerOption {
 	return func(o *serverOptions) error {
+		if interceptor == nil {
+			return optionError("no interceptor specified")
+		}
+		o.addInterceptor("", interceptor)
+		return nil
+	}
+}
+
+// WithNamedServerInterceptor adds a named interceptor for method calls on
+// the server side. It behaves like WithServerInterceptor, but the name is
+// reported by Server.InterceptorChain.
+func WithNamedServerInterceptor(interceptor NamedInterceptor) ServerOption {
+	return func(o *serverOptions) error {
+		switch {
+		case interceptor.Name == "":
+			return optionError("missing interceptor name")
+		case interceptor.Interceptor == nil:
+			return optionError("no interceptor specified")
+		}
+		o.addInterceptor(interceptor.Name, interceptor.Interceptor)
+		return nil
+	}
+}
+
+// WithTransportInterceptor adds an interceptor for the raw requests served
+// by Server.ServeMRPC. It is possible to add multiple transport interceptors.
+// In that case they are executed in the order they are provided. If a
+// transport interceptor is added, ServeMRPC reads all data of its reader as
+// a single request. Requests passed to Server.Execute are not intercepted.
+func WithTransportInterceptor(interceptor TransportInterceptor) ServerOption {
+	return func(o *serverOptions) error {
+		if interceptor == nil {
+			return optionError("no transport interceptor specified")
+		}
+		o.transports = append(o.transports, interceptor)
+		return nil
+	}
+}
+
+// WithMiddleware adds middlewares for method calls on the server side.
+// Middlewares are part of the interceptor chain. They are executed in the
+// order they are provided, interleaved with interceptors in the order of
+// the options.
+func WithMiddleware(middlewares ...Middleware) ServerOption {
+	return func(o *serverOptions) error {
+		for _, m := range middlewares {
+			if m == nil {
+				return optionError("no middleware specified")
+			}
+			o.addInterceptor("", m.interceptor())
+		}
+		return nil
+	}
+}
+
+// WithNotFoundHandler sets a handler which is called for requests of
+// methods which are not registered, e.g. to forward them to another
+// server. The handler receives the original request body and no service.
+// Interceptors see the requested method in the CallInfo. Without a
+// not-found handler, such requests are answered with a NotFound error.
+func WithNotFoundHandler(h Handler) ServerOption {
+	return func(o *serverOptions) error {
+		if h == nil {
+			return optionError("no not-found handler specified")
+		}
+		o.notFound = h
+		return nil
+	}
+}
+
+// WithHandlerWatchdog installs a watchdog which calls log for each method
+// call that is still running after its deadline plus the given grace period
+// has passed. Such calls are typically caused by handlers which ignore the
+// context and keep running after the client gave up. The watchdog cannot
+// stop those handlers, but helps finding them. Calls without a deadline are
+// not watched.
+func WithHandlerWatchdog(grace time.Duration, log func(CallInfo)) ServerOption {
+	return func(o *serverOptions) error {
+		if log == nil {
+			return optionError("no watchdog log function specified")
+		}
+		o.watchdog = &watchdog{grace: grace, log: log}
+		return nil
+	}
+}
+
+func (o *serverOptions) addInterceptor(name string, interceptor ServerInterceptor) {
+	o.interceptors = append(o.interceptors, interceptor)
+	o.names = append(o.names, name)
+}
+
+// WithMaxErrorTextLen limits the length of the error text of responses to
+// n bytes. Longer error texts are truncated and marked with a trailing
+// ellipsis, which is part of the n bytes. The limit applies to all error
+// responses, including errors of interceptors and of decoding requests. By
+// default, error texts are not limited.
+func WithMaxErrorTextLen(n int) ServerOption {
+	return func(o *serverOptions) error {
+		if n <= 0 {
+			return optionError("non-positive maximum error text length")
+		}
+		o.maxErrorText = n
+		return nil
+	}
+}
+
+// WithMaxHeaderSize limits the encoded size of the headers of requests
+// served by Server.ServeMRPC to n bytes, e.g. to protect against peers which
+// send huge metadata maps. Requests with larger headers are rejected with a
+// ResourceExhausted error before they are executed. The limit is enforced
+// while the headers are decoded, so the decoding stops as soon as the
+// headers exceed it. Unknown header fields are skipped and do not count
+// towards the limit. By default, the headers are not limited.
+func WithMaxHeaderSize(n int) ServerOption {
+	return func(o *serverOptions) error {
+		if n <= 0 {
+			return optionError("non-positive maximum header size")
+		}
+		o.maxHeader = n
+		return nil
+	}
+}
+
+// WithProtocolVersions sets the range of protocol versions supported by the
+// server (see ProtocolVersion). Requests with a version outside of this
+// range are rejected with a FailedPrecondition error. By default, requests
+// of all versions are accepted.
+func WithProtocolVersions(min, max uint8) ServerOption {
+	return func(o *serverOptions) error {
+		if min > max {
+			return optionError("invalid protocol version range")
+		}
+		o.versions = &versionRange{min: min, max: max}
+		return nil
+	}
+}
+
+// WithMethodStats enables the collection of call statistics for each
+// registered method, which can be retrieved with Server.MethodStats. The
+// statistics include the latencies of the interceptors.
+func WithMethodStats() ServerOption {
+	return func(o *serverOptions) error {
+		o.stats = true
+		return nil
+	}
+}
+
+// WithServiceResolver sets a function which rewrites the service name of
+// each request before the method is looked up, e.g. to strip a prefix or to
+// map alias names to registered services. The rewritten name is used for
+// the rest of the call, including the not-found handling and the method
+// name reported to interceptors. Requests of the reserved ping method are
+// not rewritten. The function can be called concurrently and must be safe
+// for concurrent use.
+func WithServiceResolver(resolve func(name string) string) ServerOption {
+	return func(o *serverOptions) error {
+		if resolve == nil {
+			return optionError("no service resolver specified")
+		}
+		o.resolve = resolve
+		return nil
+	}
+}
+
+// WithInterceptorRecovery enables the recovery from panics of interceptors
+// and middlewares. A call whose interceptor panics is answered with an
+// Internal error, and log is called with the name of the interceptor (see
+// WithNamedServerInterceptor), which is empty for unnamed interceptors. If
+// log is nil, the panic is logged with the standard logger. Panics of
+// handlers are not recovered, use RecoveryInterceptor for those.
+func WithInterceptorRecovery(log func(name string, call CallInfo, p PanicInfo)) ServerOption {
+	return func(o *serverOptions) error {
+		if log == nil {
+			log = logInterceptorPanic
+		}
+		o.recoverPanic = log
+		return nil
+	}
+}
+
+// ClientOption represents an option which can be used to configure
+// an mrpc client.
+type ClientOption func(*clientOptions) error
+
+type clientOptions struct {
+	interceptors []ClientInterceptor
+	minTimeout   time.Duration
+	validate     func(Response) error
+	requestID    func() string
+	noTimeout    bool
+	clock        clock
+}
+
+func defaultClientOptions() clientOptions {
+	return clientOptions{
+		clock: realClock{},
+	}
+}
+
+func (o *clientOptions) apply(opts []ClientOption) error {
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithClientInterceptor adds an interceptor for method calls on the
+// client side. It is possible to add multiple interceptors. In that
+// case they are executed in the order they are provided.
+func WithClientInterceptor(interceptor ClientInterceptor) ClientOption {
+	return func(o *clientOptions) error {
 		if interceptor == nil {
 			return optionError("no interceptor specified")
 		}
@@ -33,3 +298,81 @@ func WithServerInterceptor(interceptor ServerInterceptor) ServerOption {
 		return nil
 	}
 }
+
+// WithMinTimeout sets the minimum remaining time of a call's context deadline
+// for the request to be sent. Calls with less time left fail immediately
+// with a Timeout error instead of sending a request, which would most
+// likely time out on the server. By default, no minimum is set.
+func WithMinTimeout(d time.Duration) ClientOption {
+	return func(o *clientOptions) error {
+		if d < 0 {
+			return optionError("negative minimum timeout")
+		}
+		o.minTimeout = d
+		return nil
+	}
+}
+
+// WithResponseValidator sets a function which validates each response after
+// it was decoded. If the validation fails, Call returns the validator's
+// error. Errors without an error code are reported with the Internal code.
+func WithResponseValidator(validate func(Response) error) ClientOption {
+	return func(o *clientOptions) error {
+		if validate == nil {
+			return optionError("no response validator specified")
+		}
+		o.validate = validate
+		return nil
+	}
+}
+
+// WithRequestIDGenerator sets a function which generates the request id
+// for each call whose request headers do not contain a request id yet. The
+// generated id is set before any client interceptor is executed. The
+// function can be called concurrently and must be safe for concurrent use.
+// The server copies the request id into the response.
+func WithRequestIDGenerator(generate func() string) ClientOption {
+	return func(o *clientOptions) error {
+		if generate == nil {
+			return optionError("no request id generator specified")
+		}
+		o.requestID = generate
+		return nil
+	}
+}
+
+// WithoutClientTimeout prevents the client from sending the remaining time
+// of a call's context deadline as the request's timeout header, e.g. for
+// servers which enforce their timeouts on their own. Timeouts set in the
+// request headers explicitly are still sent. The deadline is enforced
+// locally instead: if the client's reader provides a method
+//
+//	SetReadDeadline(t time.Time) error
+//
+// like net.Conn, it is used to bound reading the response. A call which
+// fails with a Timeout because of the read deadline leaves the connection
+// in an undefined state. Therefore the client rejects all further calls
+// with an error without error code. A ReconnectingCaller dials a new
+// connection in this case.
+func WithoutClientTimeout() ClientOption {
+	return func(o *clientOptions) error {
+		o.noTimeout = true
+		return nil
+	}
+}
+
+// withServerClock sets the clock used for the timeout handling of a server.
+func withServerClock(c clock) ServerOption {
+	return func(o *serverOptions) error {
+		o.clock = c
+		return nil
+	}
+}
+
+// withClientClock sets the clock used for the timeout handling of a client.
+func withClientClock(c clock) ClientOption {
+	return func(o *clientOptions) error {
+		o.clock = c
+		return nil
+	}
+}
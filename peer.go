@@ -0,0 +1,71 @@
+package mrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+)
+
+// ContextWithConn returns a copy of ctx which carries the peer information
+// of conn: the remote address and, for TLS connections, the connection
+// state. Network layers should derive the context passed to ServeMRPC or
+// Execute with this function, so that handlers and interceptors can access
+// the peer via PeerFromContext and TLSFromContext. For TLS connections the
+// handshake should be completed before calling ContextWithConn.
+func ContextWithConn(ctx context.Context, conn net.Conn) context.Context {
+	ctx = context.WithValue(ctx, peerKey{}, conn.RemoteAddr())
+	if c, ok := conn.(interface{ ConnectionState() tls.ConnectionState }); ok {
+		state := c.ConnectionState()
+		ctx = context.WithValue(ctx, tlsKey{}, &state)
+	}
+	return ctx
+}
+
+// PeerFromContext returns the remote address of the connection a request
+// was received on. See ContextWithConn.
+func PeerFromContext(ctx context.Context) (net.Addr, bool) {
+	addr, ok := ctx.Value(peerKey{}).(net.Addr)
+	return addr, ok
+}
+
+// TLSFromContext returns the TLS connection state of the connection a
+// request was received on. See ContextWithConn.
+func TLSFromContext(ctx context.Context) (*tls.ConnectionState, bool) {
+	state, ok := ctx.Value(tlsKey{}).(*tls.ConnectionState)
+	return state, ok
+}
+
+// ClientCertAuthInterceptor returns a server interceptor which authenticates
+// clients by their TLS certificate. The verified client certificate is read
+// from the TLS connection state in the context (see TLSFromContext) and
+// passed to verify, which maps it to an identity and returns the context
+// for the handler, e.g. carrying the identity. Requests without a verified
+// client certificate are rejected with an Unauthorized error, so the TLS
+// configuration has to verify client certificates. Errors of verify without
+// an error code are reported as Unauthorized as well. If verify returns a
+// nil context, the handler is called with the original context.
+func ClientCertAuthInterceptor(verify func(ctx context.Context, cert *x509.Certificate) (context.Context, error)) ServerInterceptor {
+	return func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		state, ok := TLSFromContext(ctx)
+		if !ok || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+			return nil, Error(Unauthorized, "missing client certificate")
+		}
+
+		verified, err := verify(ctx, state.VerifiedChains[0][0])
+		if err != nil {
+			if ErrorCode(err) == Unknown {
+				err = Error(Unauthorized, err.Error())
+			}
+			return nil, err
+		}
+		if verified != nil {
+			ctx = verified
+		}
+		return h(ctx, call.Service, call.Body)
+	}
+}
+
+type peerKey struct{}
+
+type tlsKey struct{}
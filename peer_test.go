@@ -0,0 +1,135 @@
+package mrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestContextWithConn(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4711}
+
+	t.Run("plain", func(t *testing.T) {
+		ctx := ContextWithConn(context.Background(), fakeConn{remote: addr})
+
+		if peer, ok := PeerFromContext(ctx); !ok || peer != addr {
+			t.Fatalf("unexpected peer: %v", peer)
+		}
+		if _, ok := TLSFromContext(ctx); ok {
+			t.Fatal("unexpected tls connection state")
+		}
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		conn := fakeTLSConn{
+			fakeConn: fakeConn{remote: addr},
+			state:    tls.ConnectionState{ServerName: "example.com"},
+		}
+		ctx := ContextWithConn(context.Background(), conn)
+
+		if peer, ok := PeerFromContext(ctx); !ok || peer != addr {
+			t.Fatalf("unexpected peer: %v", peer)
+		}
+		if state, ok := TLSFromContext(ctx); !ok || state.ServerName != "example.com" {
+			t.Fatalf("unexpected tls connection state: %v", state)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		if _, ok := PeerFromContext(context.Background()); ok {
+			t.Fatal("unexpected peer")
+		}
+	})
+}
+
+type fakeConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c fakeConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+type fakeTLSConn struct {
+	fakeConn
+	state tls.ConnectionState
+}
+
+func (c fakeTLSConn) ConnectionState() tls.ConnectionState {
+	return c.state
+}
+
+func TestClientCertAuthInterceptor(t *testing.T) {
+	type identityKey struct{}
+
+	var (
+		handlerCtx context.Context
+		identity   interface{}
+	)
+	s := newServer(t, WithServerInterceptor(ClientCertAuthInterceptor(func(ctx context.Context, cert *x509.Certificate) (context.Context, error) {
+		switch cert.Subject.CommonName {
+		case "client":
+		case "anonymous":
+			return nil, nil
+		default:
+			return nil, errors.New("unknown client")
+		}
+		return context.WithValue(ctx, identityKey{}, cert.Subject.CommonName), nil
+	})))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					handlerCtx, identity = ctx, ctx.Value(identityKey{})
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	connContext := func(commonName string) context.Context {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		return ContextWithConn(context.Background(), fakeTLSConn{
+			state: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			},
+		})
+	}
+
+	req := Request{Service: "my-service", Method: 1}
+
+	resp := s.Execute(connContext("client"), req)
+	if err := ResponseError(resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if identity != "client" {
+		t.Fatalf("unexpected identity: %v", identity)
+	}
+
+	resp = s.Execute(connContext("anonymous"), req)
+	if err := ResponseError(resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if handlerCtx == nil {
+		t.Fatalf("unexpected nil context")
+	} else if identity != nil {
+		t.Fatalf("unexpected identity: %v", identity)
+	}
+
+	resp = s.Execute(connContext("other"), req)
+	if resp.ErrorCode != Unauthorized {
+		t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+	}
+
+	resp = s.Execute(ContextWithConn(context.Background(), fakeConn{}), req)
+	if resp.ErrorCode != Unauthorized {
+		t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+	}
+}
@@ -0,0 +1,29 @@
+package mrpc
+
+import (
+	"context"
+)
+
+// The reserved ping method. Requests of this method are answered by each
+// server with an empty response without being registered explicitly and
+// without running any interceptors. The service name cannot be registered.
+const (
+	PingService = "mrpc.ping"
+	PingMethod  = 0
+)
+
+// Ping checks the liveness of the client's connection by calling the
+// reserved ping method (see PingService). It returns an error if the
+// request could not be sent or the response could not be received, e.g.
+// because the connection is dead. Client interceptors are not executed.
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.call(ctx, Request{Service: PingService, Method: PingMethod})
+	if err != nil {
+		return err
+	}
+	return resp.Err()
+}
+
+func isPing(req Request) bool {
+	return req.Service == PingService && req.Method == PingMethod
+}
@@ -0,0 +1,50 @@
+package mrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+
+	intercepted := false
+	s := newServer(t, WithServerInterceptor(func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		intercepted = true
+		return nil, Error(Unauthorized, "unauthorized")
+	}))
+
+	client := NewClient(newClientConn(func(req Request) Response {
+		return s.Execute(ctx, req)
+	}))
+	if err := client.Ping(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if intercepted {
+		t.Fatal("unexpected interceptor call")
+	}
+
+	errDead := errors.New("connection closed")
+	client = NewClient(deadConn{err: errDead})
+	if err := client.Ping(ctx); !errors.Is(err, errDead) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPingServiceReserved(t *testing.T) {
+	s := newServer(t)
+
+	defer func() {
+		if msg := recover(); msg != "service name mrpc.ping is reserved" {
+			t.Fatalf("unexpected panic message: %v", msg)
+		}
+	}()
+	s.Register(ServiceSpec{Name: PingService, Service: struct{}{}})
+}
+
+type deadConn struct {
+	err error
+}
+
+func (c deadConn) Read(p []byte) (int, error)  { return 0, c.err }
+func (c deadConn) Write(p []byte) (int, error) { return 0, c.err }
@@ -0,0 +1,188 @@
+package mrpc
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Backoff configures an exponential backoff between connection attempts.
+// Zero values are replaced with the values of DefaultBackoff.
+type Backoff struct {
+	Initial     time.Duration // delay after the first failed attempt
+	Max         time.Duration // maximum delay between two attempts
+	Multiplier  float64       // factor by which the delay grows per attempt
+	MaxAttempts int           // maximum number of attempts
+}
+
+// DefaultBackoff holds the default backoff configuration.
+var DefaultBackoff = Backoff{
+	Initial:     100 * time.Millisecond,
+	Max:         10 * time.Second,
+	Multiplier:  2,
+	MaxAttempts: 5,
+}
+
+func (b Backoff) withDefaults() Backoff {
+	if b.Initial <= 0 {
+		b.Initial = DefaultBackoff.Initial
+	}
+	if b.Max <= 0 {
+		b.Max = DefaultBackoff.Max
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = DefaultBackoff.Multiplier
+	}
+	if b.MaxAttempts <= 0 {
+		b.MaxAttempts = DefaultBackoff.MaxAttempts
+	}
+	return b
+}
+
+// ReconnectingCaller is a caller which maintains a single connection and
+// re-establishes it on transport errors. A transport error is an error
+// returned by Client.Call without an error code. In this case the
+// connection is closed, a new connection is dialed with an exponential
+// backoff, and the call is repeated once on the new connection. Therefore
+// only idempotent methods should be called with a ReconnectingCaller.
+//
+// Calls are serialized on the connection. A ReconnectingCaller is safe for
+// concurrent use.
+type ReconnectingCaller struct {
+	dial    func(ctx context.Context) (io.ReadWriteCloser, error)
+	backoff Backoff
+	opts    []ClientOption
+
+	mtx    sync.Mutex
+	conn   io.ReadWriteCloser
+	client *Client
+}
+
+// NewReconnectingCaller creates a new reconnecting caller, which uses dial
+// to establish connections. The client options are applied to the client
+// of every connection. The first connection is dialed on the first call.
+// The context passed to dial is the context of the call, which dial should
+// honor, e.g. with net.Dialer.DialContext. A dial which is still running
+// when the context is done is abandoned and the call fails with a Timeout
+// or Canceled error. The connection of an abandoned dial is closed as soon
+// as the dial returns.
+func NewReconnectingCaller(dial func(ctx context.Context) (io.ReadWriteCloser, error), backoff Backoff, opts ...ClientOption) *ReconnectingCaller {
+	return &ReconnectingCaller{
+		dial:    dial,
+		backoff: backoff.withDefaults(),
+		opts:    opts,
+	}
+}
+
+// Call implements the Caller interface.
+func (c *ReconnectingCaller) Call(ctx context.Context, req Request) (Response, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	redialed := c.client == nil
+	if redialed {
+		if err := c.connect(ctx); err != nil {
+			return Response{}, err
+		}
+	}
+
+	resp, err := c.client.Call(ctx, req)
+	if err == nil || ErrorCode(err) != Unknown {
+		if err != nil && c.client.isBroken() {
+			c.disconnect()
+		}
+		return resp, err
+	}
+
+	c.disconnect()
+	if redialed {
+		return resp, err
+	}
+
+	if err = c.connect(ctx); err != nil {
+		return Response{}, err
+	}
+	if resp, err = c.client.Call(ctx, req); err != nil && (ErrorCode(err) == Unknown || c.client.isBroken()) {
+		c.disconnect()
+	}
+	return resp, err
+}
+
+// Close closes the current connection. A subsequent call dials a new
+// connection.
+func (c *ReconnectingCaller) Close() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.client = nil, nil
+	return err
+}
+
+func (c *ReconnectingCaller) connect(ctx context.Context) error {
+	delay := c.backoff.Initial
+	for attempt := 1; ; attempt++ {
+		conn, err := c.dialContext(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err == nil {
+			c.conn = conn
+			c.client = NewClient(conn, c.opts...)
+			return nil
+		}
+		if attempt == c.backoff.MaxAttempts {
+			return Errorf(Unavailable, "dial: %s", err.Error())
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+
+		if delay = time.Duration(float64(delay) * c.backoff.Multiplier); delay > c.backoff.Max {
+			delay = c.backoff.Max
+		}
+	}
+}
+
+// dialContext calls dial and returns as soon as ctx is done, even if dial
+// does not honor ctx.
+func (c *ReconnectingCaller) dialContext(ctx context.Context) (io.ReadWriteCloser, error) {
+	type result struct {
+		conn io.ReadWriteCloser
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		conn, err := c.dial(ctx)
+		done <- result{conn: conn, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err == nil && ctx.Err() != nil {
+			r.conn.Close()
+		}
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.err == nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func (c *ReconnectingCaller) disconnect() {
+	c.conn.Close()
+	c.conn, c.client = nil, nil
+}
@@ -0,0 +1,187 @@
+package mrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReconnectingCaller(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		dials    int
+		dialErrs = 2
+		conns    []*reconnectConn
+	)
+	dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		dials++
+		if dials > 1 && dialErrs > 0 {
+			dialErrs--
+			return nil, errors.New("connection refused")
+		}
+		conn := &reconnectConn{clientConn: newClientConn(func(req Request) Response {
+			return Response{Body: req.Body}
+		})}
+		conns = append(conns, conn)
+		return conn, nil
+	}
+
+	caller := NewReconnectingCaller(dial, Backoff{Initial: time.Millisecond, MaxAttempts: 3})
+
+	resp, err := caller.Call(ctx, Request{Body: []byte("first")})
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case string(resp.Body) != "first":
+		t.Fatalf("unexpected response body: %q", resp.Body)
+	case dials != 1:
+		t.Fatalf("unexpected number of dials: %d", dials)
+	}
+
+	// simulate a connection drop
+	conns[0].broken = true
+
+	resp, err = caller.Call(ctx, Request{Body: []byte("second")})
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case string(resp.Body) != "second":
+		t.Fatalf("unexpected response body: %q", resp.Body)
+	case dials != 4:
+		t.Fatalf("unexpected number of dials: %d", dials)
+	case !conns[0].closed:
+		t.Fatal("broken connection not closed")
+	}
+}
+
+func TestReconnectingCallerDialFailure(t *testing.T) {
+	dials := 0
+	dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		dials++
+		return nil, errors.New("connection refused")
+	}
+
+	caller := NewReconnectingCaller(dial, Backoff{Initial: time.Millisecond, MaxAttempts: 3})
+	if _, err := caller.Call(context.Background(), Request{}); ErrorCode(err) != Unavailable {
+		t.Fatalf("unexpected error: %v", err)
+	} else if dials != 3 {
+		t.Fatalf("unexpected number of dials: %d", dials)
+	}
+}
+
+func TestReconnectingCallerReadTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var conns []*reconnectConn
+	dial := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		conn := &reconnectConn{clientConn: newClientConn(func(req Request) Response {
+			return Response{Body: req.Body}
+		})}
+		conns = append(conns, conn)
+		return &deadlineReconnectConn{reconnectConn: conn, expired: len(conns) == 1}, nil
+	}
+
+	caller := NewReconnectingCaller(dial, Backoff{Initial: time.Millisecond}, WithoutClientTimeout())
+	if _, err := caller.Call(ctx, Request{Body: []byte("first")}); ErrorCode(err) != Timeout {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !conns[0].closed {
+		t.Fatal("timed out connection not closed")
+	}
+
+	resp, err := caller.Call(ctx, Request{Body: []byte("second")})
+	switch {
+	case err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case string(resp.Body) != "second":
+		t.Fatalf("unexpected response body: %q", resp.Body)
+	case len(conns) != 2:
+		t.Fatalf("unexpected number of dials: %d", len(conns))
+	}
+}
+
+func TestReconnectingCallerDialDeadline(t *testing.T) {
+	tests := map[string]struct {
+		honorCtx bool
+		cancel   bool
+		code     ErrCode
+	}{
+		"deadline":            {honorCtx: true, code: Timeout},
+		"canceled":            {honorCtx: true, cancel: true, code: Canceled},
+		"deadline-ignored":    {code: Timeout},
+		"cancelation-ignored": {cancel: true, code: Canceled},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			release := make(chan struct{})
+			defer close(release)
+			dialed := make(chan struct{})
+			honorCtx := test.honorCtx // the abandoned dial outlives the subtest
+			dial := func(dialCtx context.Context) (io.ReadWriteCloser, error) {
+				close(dialed)
+				if honorCtx {
+					<-dialCtx.Done()
+					return nil, dialCtx.Err()
+				}
+				<-release
+				return &reconnectConn{clientConn: newClientConn(nil)}, nil
+			}
+
+			if test.cancel {
+				go func() {
+					<-dialed
+					cancel()
+				}()
+			}
+
+			caller := NewReconnectingCaller(dial, Backoff{Initial: time.Millisecond})
+			if _, err := caller.Call(ctx, Request{}); ErrorCode(err) != test.code {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+type reconnectConn struct {
+	*clientConn
+	broken bool
+	closed bool
+}
+
+func (c *reconnectConn) Read(p []byte) (int, error) {
+	if c.broken {
+		return 0, io.EOF
+	}
+	return c.clientConn.Read(p)
+}
+
+func (c *reconnectConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+// deadlineReconnectConn supports read deadlines. If expired is set, all
+// reads fail with a deadline error.
+type deadlineReconnectConn struct {
+	*reconnectConn
+	expired bool
+}
+
+func (c *deadlineReconnectConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *deadlineReconnectConn) Read(p []byte) (int, error) {
+	if c.expired {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return c.reconnectConn.Read(p)
+}
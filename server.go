@@ -1,10 +1,17 @@
 package mrpc
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"reflect"
+	"runtime"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/mprot/msgpack-go"
 )
@@ -20,10 +27,43 @@ type Handler func(ctx context.Context, svc interface{}, body []byte) ([]byte, er
 
 // MethodSpec holds the data for a single method. A method has a unique
 // id within the defined service and a handler which completes all
-// incoming requests.
+// incoming requests. The handler must not be nil.
+//
+// Multiple versions of a method can be registered under the same id by
+// specifying different versions. Requests select a version with the
+// MethodVersion header. Requests without a version are routed to the
+// highest registered version. Version 0 denotes an unversioned method,
+// which cannot be combined with other versions under the same id.
+//
+// Aliases specifies additional ids under which the method can be called,
+// e.g. to keep the old id of a renamed method working. Calls via an alias
+// are reported with the method's id to interceptors.
+//
+// Calls of a deprecated method succeed as usual, but the response metadata
+// carries a deprecation warning (see DeprecatedKey) with the specified
+// message or a default message if none is given.
+//
+// Variants specifies alternative handlers of the method, e.g. for canary
+// deployments. For each call, SelectVariant selects the name of the variant
+// from the request headers. Without a selector, the value of the request
+// metadata key VariantKey is used. If no variant with the selected name
+// exists, Handler is called.
+//
+// Calls of a method with a rate limit which exceed the limit are rejected
+// with a ResourceExhausted error before any interceptor is called. The
+// response metadata tells the client when to retry (see RetryAfterKey).
+// Each version of a method has its own limit, which is shared by its
+// aliases and variants.
 type MethodSpec struct {
-	ID      int
-	Handler Handler
+	ID                 int
+	Aliases            []int
+	Version            int
+	Deprecated         bool
+	DeprecationMessage string
+	Handler            Handler
+	Variants           map[string]Handler
+	SelectVariant      func(RequestHeaders) string
+	RateLimit          *RateLimit
 }
 
 // ServiceSpec holds the data for a service. A service has a unique name
@@ -37,9 +77,22 @@ type ServiceSpec struct {
 // Server is a mrpc server, where services can be registered. A server is
 // transport independent and the network layer has to be implemented separately.
 type Server struct {
-	services  map[string]struct{} // set of service names
-	methods   map[string]method   // method id => method
-	intercept ServerInterceptor
+	name       string
+	services   map[string]ServiceSpec // registered services by name
+	idempotent bool                   // see WithIdempotentRegister
+	methods    map[methodKey]method
+	intercept  ServerInterceptor
+	names      []string // interceptor names in execution order
+	transports []TransportInterceptor
+	notFound   Handler
+	watchdog   *watchdog
+	maxErrLen  int // maximum error text length, 0 if unlimited
+	maxHeader  int // maximum encoded header size, 0 if unlimited
+	versions   *versionRange
+	stats      bool // collect method statistics
+	resolve    func(string) string
+	clock      clock
+	encode     func(io.Writer, *Response) error // response encoder
 }
 
 // NewServer creates a new mrpc server with the given options.
@@ -49,10 +102,29 @@ func NewServer(o ...ServerOption) (*Server, error) {
 		return nil, err
 	}
 
+	if opts.recoverPanic != nil {
+		for i, intercept := range opts.interceptors {
+			opts.interceptors[i] = recoverInterceptor(opts.names[i], intercept, opts.recoverPanic)
+		}
+	}
+
 	return &Server{
-		services:  make(map[string]struct{}),
-		methods:   make(map[string]method),
-		intercept: serverInterceptorChain(opts.interceptors),
+		name:       opts.name,
+		services:   make(map[string]ServiceSpec),
+		idempotent: opts.idempotent,
+		methods:    make(map[methodKey]method),
+		intercept:  serverInterceptorChain(opts.interceptors),
+		names:      opts.names,
+		transports: opts.transports,
+		notFound:   opts.notFound,
+		watchdog:   opts.watchdog,
+		maxErrLen:  opts.maxErrorText,
+		maxHeader:  opts.maxHeader,
+		versions:   opts.versions,
+		stats:      opts.stats,
+		resolve:    opts.resolve,
+		clock:      opts.clock,
+		encode:     encodeMsgpackResponse,
 	}, nil
 }
 
@@ -60,75 +132,595 @@ func NewServer(o ...ServerOption) (*Server, error) {
 // specification is passed or a service with the same id was already
 // registered, the function will panic.
 func (s *Server) Register(svc ServiceSpec) {
-	if svc.Name == "" {
-		panic("missing service name")
-	} else if svc.Service == nil {
-		panic("missing service")
-	} else if _, has := s.services[svc.Name]; has {
-		panic("service " + svc.Name + " already registered")
+	if err := s.TryRegister(svc); err != nil {
+		panic(err.Error())
+	}
+}
+
+// TryRegister registers a service to the server like Register, but returns
+// an error instead of panicking.
+func (s *Server) TryRegister(svc ServiceSpec) error {
+	if err := validateServiceSpec(svc); err != nil {
+		return err
+	} else if registered, has := s.services[svc.Name]; has {
+		if s.idempotent && sameServiceSpec(registered, svc) {
+			return nil
+		}
+		return errors.New("service " + svc.Name + " already registered")
 	}
 
 	for _, m := range svc.Methods {
-		s.methods[methodKey(svc.Name, m.ID)] = method{
+		key := methodKey{service: svc.Name, id: m.ID}
+		meth := method{
+			name:    key.String(),
+			version: m.Version,
 			svc:     svc.Service,
 			handler: m.Handler,
 		}
+		if len(m.Variants) != 0 {
+			meth.variants = m.Variants
+			meth.selectVariant = m.SelectVariant
+			if meth.selectVariant == nil {
+				meth.selectVariant = selectVariantByMetadata
+			}
+		}
+		if m.RateLimit != nil {
+			meth.limiter = newRateLimiter(*m.RateLimit)
+		}
+		if m.Deprecated {
+			meth.deprecation = m.DeprecationMessage
+			if meth.deprecation == "" {
+				meth.deprecation = "method " + meth.name + " is deprecated"
+			}
+		}
+		if s.stats {
+			// All versions of a method share their statistics.
+			if m, has := s.methods[key]; has {
+				meth.stats = m.stats
+			} else {
+				meth.stats = &latencyHistogram{}
+			}
+		}
+
+		s.addMethod(key, meth)
+		for _, alias := range m.Aliases {
+			s.addMethod(methodKey{service: svc.Name, id: alias}, meth)
+		}
+	}
+	s.services[svc.Name] = svc
+	return nil
+}
+
+// validateServiceSpec checks the service specification for errors which
+// prevent its registration, independent of the services which are already
+// registered.
+func validateServiceSpec(svc ServiceSpec) error {
+	if svc.Name == "" {
+		return errors.New("missing service name")
+	} else if svc.Service == nil {
+		return errors.New("missing service")
+	} else if svc.Name == PingService {
+		return errors.New("service name " + svc.Name + " is reserved")
+	}
+
+	ids := make(map[methodKey]struct{}) // id and version of all methods
+	versioned := make(map[int]struct{}) // ids of all versioned methods
+	for _, m := range svc.Methods {
+		key := methodKey{id: m.ID, version: m.Version}
+		if m.Version < 0 {
+			return errors.New("invalid version for method " + methodKey{service: svc.Name, id: m.ID}.String())
+		} else if m.Handler == nil {
+			return errors.New("nil handler for method " + methodKey{service: svc.Name, id: m.ID}.String())
+		} else if m.RateLimit != nil && !(m.RateLimit.PerSecond > 0 && m.RateLimit.Burst >= 0) {
+			return errors.New("invalid rate limit for method " + methodKey{service: svc.Name, id: m.ID}.String())
+		} else if _, has := ids[key]; has {
+			return errors.New("duplicate method id " + strconv.Itoa(m.ID) + " in service " + svc.Name)
+		}
+		for name, h := range m.Variants {
+			if h == nil {
+				return errors.New("nil handler for variant " + name + " of method " + methodKey{service: svc.Name, id: m.ID}.String())
+			}
+		}
+		ids[key] = struct{}{}
+		if m.Version != 0 {
+			versioned[m.ID] = struct{}{}
+		}
+	}
+	for _, m := range svc.Methods {
+		for _, alias := range m.Aliases {
+			key := methodKey{id: alias, version: m.Version}
+			if _, has := ids[key]; has {
+				return errors.New("alias " + strconv.Itoa(alias) + " of method " + methodKey{service: svc.Name, id: m.ID}.String() + " already in use")
+			}
+			ids[key] = struct{}{}
+			if m.Version != 0 {
+				versioned[alias] = struct{}{}
+			}
+		}
+	}
+	// The unversioned key of a method refers to its highest version, so it
+	// cannot hold an unversioned method at the same time.
+	for _, m := range svc.Methods {
+		if m.Version != 0 {
+			continue
+		}
+		for _, id := range append([]int{m.ID}, m.Aliases...) {
+			if _, has := versioned[id]; has {
+				return errors.New("unversioned method " + methodKey{service: svc.Name, id: m.ID}.String() + " conflicts with versioned method id " + strconv.Itoa(id))
+			}
+		}
+	}
+	return nil
+}
+
+// sameServiceSpec reports whether both specifications are identical in the
+// sense of WithIdempotentRegister.
+func sameServiceSpec(a, b ServiceSpec) bool {
+	if a.Name != b.Name || !sameValue(a.Service, b.Service) || len(a.Methods) != len(b.Methods) {
+		return false
+	}
+	for i := range a.Methods {
+		ma, mb := a.Methods[i], b.Methods[i]
+		switch {
+		case ma.ID != mb.ID || ma.Version != mb.Version:
+			return false
+		case ma.Deprecated != mb.Deprecated || ma.DeprecationMessage != mb.DeprecationMessage:
+			return false
+		case !reflect.DeepEqual(ma.Aliases, mb.Aliases) || !reflect.DeepEqual(ma.RateLimit, mb.RateLimit):
+			return false
+		case !sameFunc(ma.Handler, mb.Handler) || !sameFunc(ma.SelectVariant, mb.SelectVariant):
+			return false
+		case len(ma.Variants) != len(mb.Variants):
+			return false
+		}
+		for name, h := range ma.Variants {
+			if !sameFunc(h, mb.Variants[name]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sameValue reports whether a and b are equal. Values of types which are
+// not comparable are never equal.
+func sameValue(a, b interface{}) bool {
+	t := reflect.TypeOf(a)
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
+
+// sameFunc reports whether the functions f and g are the same top-level
+// function, or are both nil. Closures and method values share their code
+// pointer between values which capture different state, so they are never
+// the same.
+func sameFunc(f, g interface{}) bool {
+	vf, vg := reflect.ValueOf(f), reflect.ValueOf(g)
+	if vf.IsNil() || vg.IsNil() {
+		return vf.IsNil() == vg.IsNil()
+	}
+	return vf.Pointer() == vg.Pointer() && isTopLevelFunc(vf.Pointer())
+}
+
+// isTopLevelFunc reports whether pc is the entry of a top-level function or
+// method. Closures are named after their enclosing function with a suffix
+// like ".func1" or ".1", and method values with a suffix "-fm".
+func isTopLevelFunc(pc uintptr) bool {
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return false
+	}
+	name := fn.Name()
+	if strings.HasSuffix(name, "-fm") {
+		return false
+	}
+	last := strings.TrimPrefix(name[strings.LastIndexByte(name, '.')+1:], "func")
+	if last == "" {
+		return true
+	}
+	for _, c := range last {
+		if c < '0' || c > '9' {
+			return true
+		}
+	}
+	return false
+}
+
+// Group returns a registry which registers services under the given
+// prefix. The name of each service registered at the returned registry is
+// prefixed with the group prefix followed by a dot, e.g. the service
+// "invoices" in the group "billing" is registered as "billing.invoices".
+// If the prefix is empty, the function will panic.
+func (s *Server) Group(prefix string) Registry {
+	if prefix == "" {
+		panic("missing group prefix")
+	}
+	return serviceGroup{server: s, prefix: prefix + "."}
+}
+
+// InterceptorChain returns the names of the interceptors in the order they
+// are executed for calls of the given method. The service name is resolved
+// as in Execute (see WithServiceResolver). Interceptors and middlewares
+// which were added without a name (see WithNamedServerInterceptor) are
+// reported with an empty name. Only the interceptors of the server are
+// listed: middlewares of a single method, e.g. added with the Use, Timeout
+// or Validate methods of a ServiceBuilder, wrap the method's handler and
+// are not part of the chain. If the method is not registered and no
+// not-found handler is set, nil is returned.
+func (s *Server) InterceptorChain(service string, method int) []string {
+	if s.resolve != nil {
+		service = s.resolve(service)
+	}
+	if _, has := s.methods[methodKey{service: service, id: method}]; !has && s.notFound == nil {
+		return nil
 	}
-	s.services[svc.Name] = struct{}{}
+	return append(make([]string, 0, len(s.names)), s.names...)
 }
 
-// Execute executes a single request and calls the corresponding method.
-// If the requested service or method was not registered, an error response
-// will be returned.
+// ServerNameFromContext returns the name of the server executing the method
+// call associated with ctx (see WithServerName). If the server has no name
+// or ctx does not belong to a call executed by a Server, an empty string is
+// returned.
+func ServerNameFromContext(ctx context.Context) string {
+	if info, ok := ctx.Value(responseInfoKey{}).(*responseInfo); ok {
+		return info.server
+	}
+	return ""
+}
+
+// Execute executes a single request and calls the corresponding method. The
+// requested service name can be rewritten before the method is looked up
+// (see WithServiceResolver). If the requested service or method was not
+// registered, the not-found handler is called (see WithNotFoundHandler).
+// Without such a handler, an error response will be returned. The handler's
+// deadline is the earlier one of the deadline of ctx and the timeout
+// specified in the request headers. Without a timeout in the request
+// headers, the deadline of ctx is passed on unchanged, and a handler called
+// with a context without deadline runs unbounded. Callers of Execute which
+// do not serve requests of remote clients should therefore bound ctx
+// themselves. Requests of the reserved ping method are answered with an
+// empty response (see PingService). Requests with an unsupported protocol
+// version are rejected (see WithProtocolVersions), so callers which build
+// requests on their own should set the Version header to ProtocolVersion.
+// The request id of the request headers is copied into the response.
 func (s *Server) Execute(ctx context.Context, req Request) Response {
-	key := methodKey(req.Service, req.Method)
-	method, has := s.methods[key]
-	if !has {
-		return ErrorResponsef(NotFound, "method %s not found", key)
+	resp := s.execute(ctx, req)
+	resp.ErrorText = truncateText(resp.ErrorText, s.maxErrLen)
+	resp.RequestID = req.Headers.RequestID
+	return resp
+}
+
+func (s *Server) execute(ctx context.Context, req Request) Response {
+	if isPing(req) {
+		return Response{}
+	} else if err := s.versions.check(req.Headers.Version); err != nil {
+		return ErrorResponse(err)
+	}
+
+	if s.resolve != nil {
+		req.Service = s.resolve(req.Service)
+	}
+
+	method, has := s.methods[methodKey{service: req.Service, id: req.Method, version: req.Headers.MethodVersion}]
+	switch {
+	case has:
+	case s.notFound != nil:
+		method.name = methodKey{service: req.Service, id: req.Method}.String()
+		method.handler = s.notFound
+	case req.Headers.MethodVersion != 0:
+		return ErrorResponsef(NotFound, "method %s:%d version %d not found", req.Service, req.Method, req.Headers.MethodVersion)
+	default:
+		return ErrorResponsef(NotFound, "method %s:%d not found", req.Service, req.Method)
+	}
+
+	if method.limiter != nil {
+		if ok, retryAfter := method.limiter.allow(s.clock.Now()); !ok {
+			resp := ErrorResponsef(ResourceExhausted, "rate limit of method %s exceeded", method.name)
+			resp.Metadata = map[string]string{RetryAfterKey: retryAfter.String()}
+			return resp
+		}
+	}
+
+	if method.variants != nil {
+		if h, has := method.variants[method.selectVariant(req.Headers)]; has {
+			method.handler = h
+		}
 	}
 
 	call := CallInfo{
 		Service: method.svc,
-		Method:  key,
+		Method:  method.name,
+		Headers: req.Headers,
 		Body:    req.Body,
 	}
 
 	cancel := func() {}
 	if req.Headers.Timeout != 0 {
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(req.Headers.Timeout))
+		deadline := s.clock.Now().Add(time.Duration(req.Headers.Timeout))
+		if d, ok := ctx.Deadline(); !ok || deadline.Before(d) {
+			ctx, cancel = s.clock.WithDeadline(ctx, deadline)
+		}
 	}
 
-	resp, err := s.intercept(ctx, call, method.handler)
+	ctx, info := withResponseInfo(ctx, s.name, req.Headers.BodyEncoding)
+	call.Values = &info.values
+	if method.deprecation != "" {
+		info.setMetadata(DeprecatedKey, method.deprecation)
+	}
+	var start time.Time
+	if method.stats != nil {
+		start = time.Now()
+	}
+	stop := s.watch(ctx, call)
+	body, err := s.intercept(ctx, call, method.handler)
+	stop()
 	cancel()
+	if method.stats != nil {
+		method.stats.record(time.Since(start), err != nil)
+	}
+
+	resp := Response{Body: body}
 	if err != nil {
-		return ErrorResponse(err)
+		resp = ErrorResponse(err)
 	}
-	return Response{Body: resp}
+	info.apply(&resp)
+	return resp
 }
 
 // ServeMRPC serves a request read from r and writes the response back to w.
-// This function only returns an error, if the encoding of the response fails.
-// All other errors are encoded in the response and written to w. The reader
-// should provide a single request only.
+// If the encoding of the response fails, a response with an Internal error
+// is written instead. This function only returns an error, if the encoding
+// of this fallback response fails or a transport interceptor returns an
+// error. All other errors are encoded in the response and written to w.
+// The reader should provide a single request only. If the length of the
+// reader's data is known, e.g. for a *bytes.Reader or a *bytes.Buffer,
+// requests followed by further data are rejected with an InvalidArgument
+// error. Other readers, e.g. connections, are not checked for further data,
+// so serving a request does not wait for the peer to close the connection.
 func (s *Server) ServeMRPC(ctx context.Context, r io.Reader, w io.Writer) error {
-	var (
-		req  Request
-		resp Response
-	)
+	_, _, err := s.ServeMRPCN(ctx, r, w)
+	return err
+}
+
+// ServeMRPCN serves a request like ServeMRPC and additionally returns the
+// number of bytes read from r and written to w, e.g. for accounting the
+// bandwidth of each request.
+func (s *Server) ServeMRPCN(ctx context.Context, r io.Reader, w io.Writer) (bytesIn, bytesOut int, err error) {
+	cr := &countingReader{r: r}
+	if len(s.transports) != 0 {
+		return s.serveTransport(ctx, cr, w)
+	}
+
+	resp := s.serve(ctx, cr)
+
+	// The response is encoded into a pooled buffer and written at once. The
+	// buffer is not referenced anymore after the write has returned.
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := s.encodeResponse(buf, &resp); err != nil {
+		return cr.n, 0, err
+	}
+	n, err := w.Write(buf.Bytes())
+	return cr.n, n, err
+}
+
+// serve decodes a request from r and executes it.
+func (s *Server) serve(ctx context.Context, r io.Reader) Response {
+	var req Request
+	if err := decodeRequest(r, &req, s.maxHeader); err != nil {
+		resp := ErrorResponsef(ErrorCode(err), "decode request: %s", err.Error())
+		resp.ErrorText = truncateText(resp.ErrorText, s.maxErrLen)
+		return resp
+	}
+	return s.Execute(ctx, req)
+}
+
+// serveTransport serves the raw request read from r through the transport
+// interceptors.
+func (s *Server) serveTransport(ctx context.Context, r *countingReader, w io.Writer) (bytesIn, bytesOut int, err error) {
+	var resp []byte
+	if raw, rerr := io.ReadAll(r); rerr != nil {
+		errResp := ErrorResponsef(Unknown, "decode request: %s", rerr.Error())
+		errResp.ErrorText = truncateText(errResp.ErrorText, s.maxErrLen)
+		resp, err = s.marshalResponse(&errResp)
+	} else {
+		resp, err = s.transport(ctx, raw, 0)
+	}
+	if err != nil {
+		return r.n, 0, err
+	}
+
+	n, err := w.Write(resp)
+	return r.n, n, err
+}
+
+// transport calls the i-th transport interceptor. The last interceptor
+// continues with decoding and executing the request.
+func (s *Server) transport(ctx context.Context, raw []byte, i int) ([]byte, error) {
+	if i == len(s.transports) {
+		resp := s.serve(ctx, bytes.NewReader(raw))
+		return s.marshalResponse(&resp)
+	}
+
+	return s.transports[i](ctx, raw, func(raw []byte) ([]byte, error) {
+		return s.transport(ctx, raw, i+1)
+	})
+}
+
+func (s *Server) marshalResponse(resp *Response) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := s.encodeResponse(&buf, resp); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fallbackErrorText is the error text of the response which is sent, if the
+// encoding of the actual response fails.
+const fallbackErrorText = "response encoding failed"
+
+// encodeResponse encodes resp into buf. If the encoding fails, a minimal
+// response with an Internal error is encoded instead, so that the client
+// always receives a decodable response.
+func (s *Server) encodeResponse(buf *bytes.Buffer, resp *Response) error {
+	if err := s.encode(buf, resp); err == nil {
+		return nil
+	}
+
+	buf.Reset()
+	fallback := Response{ErrorCode: Internal, ErrorText: fallbackErrorText}
+	return msgpack.Encode(buf, &fallback)
+}
+
+// encodeMsgpackResponse encodes resp into w. A panic of the encoder is
+// reported as an error.
+func encodeMsgpackResponse(w io.Writer, resp *Response) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("encode response: %v", p)
+		}
+	}()
+	return msgpack.Encode(w, resp)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
 
-	if err := msgpack.Decode(r, &req); err == nil {
-		resp = s.Execute(ctx, req)
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += n
+	return n, err
+}
+
+// truncateText truncates text to n bytes, if it is longer. The truncated
+// text ends with an ellipsis, which counts towards the n bytes, unless n is
+// too small to hold it. The text is not cut within a UTF-8 encoded
+// character. If n is 0, the text is returned unchanged.
+func truncateText(text string, n int) string {
+	const ellipsis = "..."
+
+	if n == 0 || len(text) <= n {
+		return text
+	}
+
+	suffix := ""
+	if n > len(ellipsis) {
+		n -= len(ellipsis)
+		suffix = ellipsis
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n] + suffix
+}
+
+// decodeRequest decodes a request from r. If maxHeader is positive, the
+// decoding is aborted as soon as the request headers exceed maxHeader bytes.
+// Malformed input must never crash the server, so a panic of the decoder is
+// reported as an error. If r has a
+// known length, data following the request is reported as an
+// InvalidArgument error instead of being ignored, because it most likely
+// belongs to a misframed request. Readers of unknown length may block until
+// the peer sends more data, so they are not checked.
+func decodeRequest(r io.Reader, req *Request, maxHeader int) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("malformed request: %v", p)
+		}
+	}()
+
+	mr := msgpack.NewReader(r)
+	if maxHeader > 0 {
+		err = decodeLimitedRequest(mr, req, maxHeader)
 	} else {
-		resp = ErrorResponsef(Unknown, "decode request: %s", err.Error())
+		err = req.DecodeMsgpack(mr)
+	}
+	if err != nil {
+		return err
+	}
+	if hasKnownLength(r) {
+		if err := mr.Skip(); err != io.EOF {
+			return errTrailingData
+		}
 	}
-	return msgpack.Encode(w, &resp)
+	return nil
+}
+
+// hasKnownLength reports whether r reads from data of a known length, like
+// a *bytes.Reader, which ends with io.EOF instead of blocking.
+func hasKnownLength(r io.Reader) bool {
+	if cr, ok := r.(*countingReader); ok {
+		r = cr.r
+	}
+	_, ok := r.(interface{ Len() int })
+	return ok
+}
+
+var errTrailingData = Error(InvalidArgument, "trailing data after request")
+
+// watch starts the handler watchdog for the given call, if configured, and
+// returns a function to stop it.
+func (s *Server) watch(ctx context.Context, call CallInfo) (stop func()) {
+	if s.watchdog == nil {
+		return func() {}
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return func() {}
+	}
+
+	log := s.watchdog.log
+	timer := time.AfterFunc(s.clock.Until(deadline)+s.watchdog.grace, func() { log(call) })
+	return func() { timer.Stop() }
+}
+
+type serviceGroup struct {
+	server *Server
+	prefix string
+}
+
+func (g serviceGroup) Register(svc ServiceSpec) {
+	if svc.Name == "" {
+		panic("missing service name")
+	}
+	svc.Name = g.prefix + svc.Name
+	g.server.Register(svc)
+}
+
+func (s *Server) addMethod(key methodKey, m method) {
+	// The unversioned key always refers to the highest version.
+	if latest, has := s.methods[key]; !has || latest.version <= m.version {
+		s.methods[key] = m
+	}
+	key.version = m.version
+	s.methods[key] = m
 }
 
 type method struct {
-	svc     interface{}
-	handler Handler
+	name        string // service:id
+	version     int
+	deprecation string // deprecation warning, empty if not deprecated
+	svc         interface{}
+	handler     Handler
+	stats       *latencyHistogram // nil if statistics are disabled
+	limiter     *rateLimiter      // nil if the method has no rate limit
+
+	variants      map[string]Handler // nil if the method has no variants
+	selectVariant func(RequestHeaders) string
+}
+
+func selectVariantByMetadata(h RequestHeaders) string {
+	return h.Metadata[VariantKey]
+}
+
+type methodKey struct {
+	service string
+	id      int
+	version int // 0 refers to the highest registered version
 }
 
-func methodKey(svc string, method int) string {
-	return svc + ":" + strconv.FormatInt(int64(method), 10)
+func (k methodKey) String() string {
+	return k.service + ":" + strconv.FormatInt(int64(k.id), 10)
 }
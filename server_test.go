@@ -4,6 +4,10 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -32,6 +36,49 @@ func TestServerRegisterValidation(t *testing.T) {
 		})
 	}()
 
+	func() {
+		defer ensurePanic(t, "nil handler for method my-service:1")
+		s.Register(ServiceSpec{
+			Name:    "my-service",
+			Service: struct{}{},
+			Methods: []MethodSpec{{ID: 1}},
+		})
+	}()
+
+	func() {
+		defer ensurePanic(t, "invalid rate limit for method my-service:1")
+		s.Register(ServiceSpec{
+			Name:    "my-service",
+			Service: struct{}{},
+			Methods: []MethodSpec{
+				{
+					ID: 1,
+					Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+						return nil, nil
+					},
+					RateLimit: &RateLimit{},
+				},
+			},
+		})
+	}()
+
+	func() {
+		defer ensurePanic(t, "nil handler for variant canary of method my-service:1")
+		s.Register(ServiceSpec{
+			Name:    "my-service",
+			Service: struct{}{},
+			Methods: []MethodSpec{
+				{
+					ID: 1,
+					Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+						return nil, nil
+					},
+					Variants: map[string]Handler{"canary": nil},
+				},
+			},
+		})
+	}()
+
 	func() {
 		spec := ServiceSpec{
 			Name:    "my-service",
@@ -44,6 +91,253 @@ func TestServerRegisterValidation(t *testing.T) {
 	}()
 }
 
+func TestServerRegisterDuplicateMethod(t *testing.T) {
+	handler := func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		return nil, nil
+	}
+	spec := ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{ID: 1, Handler: handler},
+			{ID: 2, Handler: handler},
+			{ID: 1, Handler: handler},
+		},
+	}
+
+	s := newServer(t)
+	err := s.TryRegister(spec)
+	if err == nil || err.Error() != "duplicate method id 1 in service my-service" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	func() {
+		defer func() {
+			if msg := recover(); msg != "duplicate method id 1 in service my-service" {
+				t.Fatalf("unexpected panic message: %v", msg)
+			}
+		}()
+		s.Register(spec)
+	}()
+
+	// The failed registrations must not leave anything behind.
+	spec.Methods = spec.Methods[:2]
+	if err := s.TryRegister(spec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestServerRegisterAliases(t *testing.T) {
+	ctx := context.Background()
+
+	var called []string
+	s := newServer(t, WithServerInterceptor(func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+		called = append(called, call.Method)
+		return h(ctx, call.Service, call.Body)
+	}))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID:      1,
+				Aliases: []int{2, 3},
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return []byte("result"), nil
+				},
+			},
+		},
+	})
+
+	for _, id := range []int{1, 2, 3} {
+		resp := s.Execute(ctx, Request{Service: "my-service", Method: id})
+		if err := ResponseError(resp); err != nil {
+			t.Fatalf("unexpected error for method %d: %v", id, err)
+		} else if string(resp.Body) != "result" {
+			t.Fatalf("unexpected result for method %d: %s", id, resp.Body)
+		}
+	}
+	if !reflect.DeepEqual(called, []string{"my-service:1", "my-service:1", "my-service:1"}) {
+		t.Fatalf("unexpected called methods: %v", called)
+	}
+
+	defer func() {
+		if msg, ok := recover().(string); !ok || msg != "alias 2 of method other-service:1 already in use" {
+			t.Fatalf("unexpected panic message: %v", msg)
+		}
+	}()
+	handler := func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		return nil, nil
+	}
+	s.Register(ServiceSpec{
+		Name:    "other-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{ID: 1, Aliases: []int{2}, Handler: handler},
+			{ID: 2, Handler: handler},
+		},
+	})
+}
+
+func TestServerRegisterIdempotent(t *testing.T) {
+	spec := ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{ID: 1, Aliases: []int{2}, Handler: idempotentHandler},
+			{ID: 3, Version: 1, Handler: idempotentHandler},
+		},
+	}
+
+	s := newServer(t, WithIdempotentRegister())
+	if err := s.TryRegister(spec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := s.TryRegister(spec); err != nil {
+		t.Fatalf("unexpected error for identical service: %v", err)
+	}
+
+	changes := map[string]func(*ServiceSpec){
+		"service": func(spec *ServiceSpec) {
+			spec.Service = struct{ x int }{1}
+		},
+		"method id": func(spec *ServiceSpec) {
+			spec.Methods[1].ID = 4
+		},
+		"alias": func(spec *ServiceSpec) {
+			spec.Methods[0].Aliases = []int{5}
+		},
+		"version": func(spec *ServiceSpec) {
+			spec.Methods[1].Version = 2
+		},
+		"handler": func(spec *ServiceSpec) {
+			spec.Methods[0].Handler = otherIdempotentHandler
+		},
+		"closure": func(spec *ServiceSpec) {
+			spec.Methods[0].Handler = func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+				return idempotentHandler(ctx, svc, body)
+			}
+		},
+		"methods": func(spec *ServiceSpec) {
+			spec.Methods = spec.Methods[:1]
+		},
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			changed := spec
+			changed.Methods = append([]MethodSpec(nil), spec.Methods...)
+			change(&changed)
+
+			err := s.TryRegister(changed)
+			if err == nil || err.Error() != "service my-service already registered" {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("not-idempotent", func(t *testing.T) {
+		s := newServer(t)
+		if err := s.TryRegister(spec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		err := s.TryRegister(spec)
+		if err == nil || err.Error() != "service my-service already registered" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestServerRegisterIdempotentClosures(t *testing.T) {
+	factory := func(result string) Handler {
+		return func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+			return []byte(result), nil
+		}
+	}
+	spec := func(h Handler) ServiceSpec {
+		return ServiceSpec{
+			Name:    "my-service",
+			Service: struct{}{},
+			Methods: []MethodSpec{{ID: 1, Handler: h}},
+		}
+	}
+
+	s := newServer(t, WithIdempotentRegister())
+	if err := s.TryRegister(spec(factory("a"))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := s.TryRegister(spec(factory("b")))
+	if err == nil || err.Error() != "service my-service already registered" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	resp := s.Execute(context.Background(), Request{Service: "my-service", Method: 1})
+	if string(resp.Body) != "a" {
+		t.Fatalf("unexpected body: %q", resp.Body)
+	}
+}
+
+func idempotentHandler(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func otherIdempotentHandler(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+	return nil, errors.New("other")
+}
+
+func TestServerGroup(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t)
+
+	spec := ServiceSpec{
+		Name:    "invoices",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return []byte("invoice"), nil
+				},
+			},
+		},
+	}
+
+	g := s.Group("billing")
+	g.Register(spec)
+
+	resp := s.Execute(ctx, Request{Service: "billing.invoices", Method: 1})
+	if err := ResponseError(resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if string(resp.Body) != "invoice" {
+		t.Fatalf("unexpected result: %s", resp.Body)
+	}
+
+	resp = s.Execute(ctx, Request{Service: "invoices", Method: 1})
+	if resp.ErrorCode != NotFound {
+		t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+	}
+
+	ensurePanic := func(t *testing.T, expectedMsg string) {
+		if msg, ok := recover().(string); !ok || msg != expectedMsg {
+			t.Fatalf("unexpected panic message: %s", msg)
+		}
+	}
+
+	func() {
+		defer ensurePanic(t, "missing group prefix")
+		s.Group("")
+	}()
+
+	func() {
+		defer ensurePanic(t, "missing service name")
+		g.Register(ServiceSpec{Service: struct{}{}})
+	}()
+
+	func() {
+		defer ensurePanic(t, "service billing.invoices already registered")
+		g.Register(spec)
+	}()
+}
+
 func TestServerExecute(t *testing.T) {
 	ctx := context.Background()
 	s := newServer(t)
@@ -76,6 +370,13 @@ func TestServerExecute(t *testing.T) {
 					return nil, nil
 				},
 			},
+			{
+				ID: 17,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				},
+			},
 		},
 	})
 
@@ -142,59 +443,1187 @@ func TestServerExecute(t *testing.T) {
 			t.Fatal("expected deadline, got none")
 		}
 	})
+
+	t.Run("method-called-with-expired-deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, time.Nanosecond)
+		defer cancel()
+		<-ctx.Done()
+
+		resp := s.Execute(ctx, Request{
+			Service: "my-service",
+			Method:  17,
+		})
+		if resp.ErrorCode != Timeout {
+			t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+		}
+	})
+
+	t.Run("method-called-with-cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		resp := s.Execute(ctx, Request{
+			Service: "my-service",
+			Method:  17,
+		})
+		if resp.ErrorCode != Canceled {
+			t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+		}
+	})
+
+	t.Run("method-called-with-context-deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		expected, _ := ctx.Deadline()
+
+		resp := s.Execute(ctx, Request{
+			Service: "my-service",
+			Method:  13,
+			Headers: RequestHeaders{Timeout: uint64(time.Minute)},
+		})
+
+		if err := ResponseError(resp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if !hasDeadline || !deadline.Equal(expected) {
+			t.Fatalf("unexpected deadline: %v (expected %v)", deadline, expected)
+		}
+	})
 }
 
-func TestServerServceMPRC(t *testing.T) {
+func TestServerExecuteVersionedMethod(t *testing.T) {
 	ctx := context.Background()
 	s := newServer(t)
 
-	expectedResult := []byte("expected result")
-	handlerCalled := false
+	handler := func(result string) Handler {
+		return func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+			return []byte(result), nil
+		}
+	}
+
 	s.Register(ServiceSpec{
 		Name:    "my-service",
 		Service: struct{}{},
 		Methods: []MethodSpec{
-			{
-				ID: 7,
-				Handler: func(ctx context.Context, svc interface{}, args []byte) ([]byte, error) {
-					handlerCalled = true
-					return expectedResult, nil
-				},
-			},
+			{ID: 1, Version: 2, Handler: handler("v2")},
+			{ID: 1, Version: 1, Handler: handler("v1")},
+			{ID: 2, Handler: handler("unversioned")},
 		},
 	})
 
-	var req bytes.Buffer
-	err := msgpack.Encode(&req, &Request{
+	tests := []struct {
+		method  int
+		version int
+		result  string
+	}{
+		{method: 1, version: 0, result: "v2"},
+		{method: 1, version: 1, result: "v1"},
+		{method: 1, version: 2, result: "v2"},
+		{method: 2, version: 0, result: "unversioned"},
+	}
+
+	for _, test := range tests {
+		resp := s.Execute(ctx, Request{
+			Service: "my-service",
+			Method:  test.method,
+			Headers: RequestHeaders{MethodVersion: test.version},
+		})
+		if err := ResponseError(resp); err != nil {
+			t.Fatalf("unexpected error for method %d version %d: %v", test.method, test.version, err)
+		} else if string(resp.Body) != test.result {
+			t.Fatalf("unexpected result for method %d version %d: %s", test.method, test.version, resp.Body)
+		}
+	}
+
+	resp := s.Execute(ctx, Request{
 		Service: "my-service",
-		Method:  7,
-		Headers: RequestHeaders{Timeout: uint64(time.Minute)},
-		Body:    []byte("request body"),
+		Method:  1,
+		Headers: RequestHeaders{MethodVersion: 3},
 	})
-	if err != nil {
+	if err := ResponseError(resp); err == nil {
+		t.Fatal("expected error, got none")
+	} else if err.Error() != "method my-service:1 version 3 not found" {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	var resp bytes.Buffer
-	err = s.ServeMRPC(ctx, &req, &resp)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	} else if !handlerCalled {
-		t.Fatal("handler not called")
+	// An unversioned method cannot share its id with versioned methods,
+	// regardless of the registration order.
+	for _, methods := range [][]MethodSpec{
+		{{ID: 1, Version: 2, Handler: handler("v2")}, {ID: 1, Handler: handler("unversioned")}},
+		{{ID: 1, Handler: handler("unversioned")}, {ID: 1, Version: 2, Handler: handler("v2")}},
+		{{ID: 1, Version: 2, Handler: handler("v2")}, {ID: 2, Aliases: []int{1}, Handler: handler("unversioned")}},
+	} {
+		err := newServer(t).TryRegister(ServiceSpec{Name: "other-service", Service: struct{}{}, Methods: methods})
+		if err == nil || !strings.HasPrefix(err.Error(), "unversioned method other-service:") {
+			t.Fatalf("unexpected error for methods %+v: %v", methods, err)
+		}
 	}
+}
 
-	var response Response
-	if err = msgpack.Decode(&resp, &response); err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	} else if err = ResponseError(response); err != nil {
-		t.Fatalf("unexpected response error: %v", err)
-	} else if !bytes.Equal(response.Body, expectedResult) {
-		t.Fatalf("unexpected return: %+v", response.Body)
+func TestServerExecuteTimeout(t *testing.T) {
+	clock := fakeClock{now: time.Now()}
+	s := newServer(t, withServerClock(clock))
+
+	var (
+		deadline    time.Time
+		hasDeadline bool
+	)
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					deadline, hasDeadline = ctx.Deadline()
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	tests := map[string]struct {
+		ctxTimeout    time.Duration // 0 for no context deadline
+		headerTimeout time.Duration
+		expected      time.Duration // 0 for no deadline
+	}{
+		"no-deadline": {},
+		"context-deadline": {
+			ctxTimeout: time.Second,
+			expected:   time.Second,
+		},
+		"header-timeout": {
+			headerTimeout: time.Microsecond,
+			expected:      time.Microsecond,
+		},
+		"context-deadline-before-header-timeout": {
+			ctxTimeout:    time.Second,
+			headerTimeout: time.Minute,
+			expected:      time.Second,
+		},
+		"header-timeout-before-context-deadline": {
+			ctxTimeout:    time.Minute,
+			headerTimeout: time.Second,
+			expected:      time.Second,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.ctxTimeout != 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, clock.now.Add(test.ctxTimeout))
+				defer cancel()
+			}
+
+			deadline, hasDeadline = time.Time{}, false
+			resp := s.Execute(ctx, Request{
+				Service: "my-service",
+				Method:  1,
+				Headers: RequestHeaders{Timeout: uint64(test.headerTimeout)},
+			})
+			switch {
+			case ResponseError(resp) != nil:
+				t.Fatalf("unexpected error: %v", ResponseError(resp))
+			case hasDeadline != (test.expected != 0):
+				t.Fatalf("unexpected deadline presence: %v", hasDeadline)
+			case hasDeadline && !deadline.Equal(clock.now.Add(test.expected)):
+				t.Fatalf("unexpected deadline: %v (expected %v)", deadline, clock.now.Add(test.expected))
+			}
+		})
 	}
 }
 
-func newServer(t *testing.T) *Server {
-	s, err := NewServer()
+func TestServerExecuteRateLimit(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Now()}
+	s := newServer(t, withServerClock(clock))
+
+	handler := func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		return nil, nil
+	}
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{ID: 1, Aliases: []int{3}, Handler: handler, RateLimit: &RateLimit{PerSecond: 2, Burst: 2}},
+			{ID: 2, Handler: handler},
+		},
+	})
+
+	execute := func(method int, expectedRetryAfter string) {
+		t.Helper()
+
+		resp := s.Execute(ctx, Request{Service: "my-service", Method: method})
+		if expectedRetryAfter == "" {
+			if err := ResponseError(resp); err != nil {
+				t.Fatalf("unexpected error for method %d: %v", method, err)
+			}
+			return
+		}
+
+		switch {
+		case resp.ErrorCode != ResourceExhausted:
+			t.Fatalf("unexpected error code for method %d: %v", method, resp.ErrorCode)
+		case resp.ErrorText != "rate limit of method my-service:1 exceeded":
+			t.Fatalf("unexpected error text for method %d: %s", method, resp.ErrorText)
+		case resp.Metadata[RetryAfterKey] != expectedRetryAfter:
+			t.Fatalf("unexpected retry after for method %d: %q", method, resp.Metadata[RetryAfterKey])
+		}
+	}
+
+	execute(1, "")
+	execute(3, "")
+	execute(1, "500ms")
+	execute(3, "500ms")
+	for i := 0; i < 5; i++ {
+		execute(2, "")
+	}
+
+	clock.now = clock.now.Add(250 * time.Millisecond)
+	execute(1, "250ms")
+
+	clock.now = clock.now.Add(250 * time.Millisecond)
+	execute(1, "")
+	execute(1, "500ms")
+
+	clock.now = clock.now.Add(time.Hour)
+	execute(1, "")
+	execute(1, "")
+	execute(1, "500ms")
+}
+
+func TestServerExecuteServiceResolver(t *testing.T) {
+	ctx := context.Background()
+
+	var methods []string
+	s := newServer(t,
+		WithServiceResolver(func(name string) string {
+			return strings.TrimPrefix(name, "v1.")
+		}),
+		WithMethodStats(),
+		WithServerInterceptor(func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+			methods = append(methods, call.Method)
+			return h(ctx, call.Service, call.Body)
+		}),
+	)
+	s.Register(ServiceSpec{
+		Name:    "users",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return []byte("user"), nil
+				},
+			},
+		},
+	})
+
+	for _, service := range []string{"v1.users", "users"} {
+		resp := s.Execute(ctx, Request{Service: service, Method: 1})
+		if err := ResponseError(resp); err != nil {
+			t.Fatalf("unexpected error for service %s: %v", service, err)
+		} else if string(resp.Body) != "user" {
+			t.Fatalf("unexpected result for service %s: %s", service, resp.Body)
+		}
+	}
+	if !reflect.DeepEqual(methods, []string{"users:1", "users:1"}) {
+		t.Fatalf("unexpected called methods: %v", methods)
+	}
+
+	resp := s.Execute(ctx, Request{Service: "v1.orders", Method: 1})
+	if resp.ErrorCode != NotFound || resp.ErrorText != "method orders:1 not found" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	resp = s.Execute(ctx, Request{Service: PingService, Method: PingMethod})
+	if err := ResponseError(resp); err != nil {
+		t.Fatalf("unexpected ping error: %v", err)
+	}
+
+	if chain := s.InterceptorChain("v1.users", 1); len(chain) != 1 {
+		t.Fatalf("unexpected interceptor chain: %v", chain)
+	}
+	if stats, ok := s.MethodStats("v1.users", 1); !ok || stats.Calls != 2 {
+		t.Fatalf("unexpected method stats: %+v (ok=%v)", stats, ok)
+	}
+}
+
+func TestServerExecuteDeprecatedMethod(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t)
+
+	handler := func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		return []byte("result"), nil
+	}
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{ID: 1, Handler: handler},
+			{ID: 2, Deprecated: true, Handler: handler},
+			{ID: 3, Deprecated: true, DeprecationMessage: "use method 1", Handler: handler},
+		},
+	})
+
+	tests := map[int]string{
+		1: "",
+		2: "method my-service:2 is deprecated",
+		3: "use method 1",
+	}
+	for id, warning := range tests {
+		resp := s.Execute(ctx, Request{Service: "my-service", Method: id})
+		if err := ResponseError(resp); err != nil {
+			t.Fatalf("unexpected error for method %d: %v", id, err)
+		} else if string(resp.Body) != "result" {
+			t.Fatalf("unexpected result for method %d: %s", id, resp.Body)
+		} else if resp.Metadata[DeprecatedKey] != warning {
+			t.Fatalf("unexpected deprecation warning for method %d: %q", id, resp.Metadata[DeprecatedKey])
+		}
+	}
+}
+
+func TestServerExecuteVariants(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t)
+
+	handler := func(result string) Handler {
+		return func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+			return []byte(result), nil
+		}
+	}
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID:       1,
+				Handler:  handler("stable"),
+				Variants: map[string]Handler{"canary": handler("canary")},
+				SelectVariant: func(h RequestHeaders) string {
+					if h.Metadata["canary"] == "true" {
+						return "canary"
+					}
+					return ""
+				},
+			},
+			{
+				ID:       2,
+				Handler:  handler("default"),
+				Variants: map[string]Handler{"a": handler("a"), "b": handler("b")},
+			},
+		},
+	})
+
+	tests := []struct {
+		method   int
+		metadata map[string]string
+		result   string
+	}{
+		{method: 1, metadata: nil, result: "stable"},
+		{method: 1, metadata: map[string]string{"canary": "true"}, result: "canary"},
+		{method: 1, metadata: map[string]string{"canary": "false"}, result: "stable"},
+		{method: 2, metadata: nil, result: "default"},
+		{method: 2, metadata: map[string]string{VariantKey: "b"}, result: "b"},
+		{method: 2, metadata: map[string]string{VariantKey: "unknown"}, result: "default"},
+	}
+
+	for _, test := range tests {
+		resp := s.Execute(ctx, Request{Service: "my-service", Method: test.method, Headers: RequestHeaders{Metadata: test.metadata}})
+		if err := ResponseError(resp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if string(resp.Body) != test.result {
+			t.Fatalf("unexpected result for method %d and metadata %v: %s", test.method, test.metadata, resp.Body)
+		}
+	}
+}
+
+func TestServerExecuteNotFoundHandler(t *testing.T) {
+	ctx := context.Background()
+
+	var calledMethods []string
+	s := newServer(t,
+		WithNotFoundHandler(func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+			return append([]byte("fallback "), body...), nil
+		}),
+		WithServerInterceptor(func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+			calledMethods = append(calledMethods, call.Method)
+			return h(ctx, call.Service, call.Body)
+		}),
+	)
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return []byte("known"), nil
+				},
+			},
+		},
+	})
+
+	tests := []struct {
+		service string
+		method  int
+		result  string
+	}{
+		{service: "my-service", method: 1, result: "known"},
+		{service: "my-service", method: 2, result: "fallback body"},
+		{service: "other-service", method: 1, result: "fallback body"},
+	}
+
+	for _, test := range tests {
+		resp := s.Execute(ctx, Request{Service: test.service, Method: test.method, Body: []byte("body")})
+		if err := ResponseError(resp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		} else if string(resp.Body) != test.result {
+			t.Fatalf("unexpected result for %s:%d: %s", test.service, test.method, resp.Body)
+		}
+	}
+
+	if expected := []string{"my-service:1", "my-service:2", "other-service:1"}; !reflect.DeepEqual(calledMethods, expected) {
+		t.Fatalf("unexpected called methods: %v", calledMethods)
+	}
+}
+
+func TestServerHandlerWatchdog(t *testing.T) {
+	ctx := context.Background()
+
+	logged := make(chan string, 2)
+	s := newServer(t, WithHandlerWatchdog(10*time.Millisecond, func(call CallInfo) {
+		logged <- call.Method
+	}))
+
+	handler := func(d time.Duration) Handler {
+		return func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+			time.Sleep(d)
+			return nil, nil
+		}
+	}
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{ID: 1, Handler: handler(0)},
+			{ID: 2, Handler: handler(100 * time.Millisecond)},
+		},
+	})
+
+	for _, id := range []int{1, 2} {
+		s.Execute(ctx, Request{
+			Service: "my-service",
+			Method:  id,
+			Headers: RequestHeaders{Timeout: uint64(10 * time.Millisecond)},
+		})
+	}
+
+	select {
+	case method := <-logged:
+		if method != "my-service:2" {
+			t.Fatalf("unexpected logged method: %s", method)
+		}
+	default:
+		t.Fatal("watchdog not fired")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if len(logged) != 0 {
+		t.Fatalf("unexpected logged method: %s", <-logged)
+	}
+}
+
+func TestServerExecuteMaxErrorTextLen(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t, WithMaxErrorTextLen(10))
+
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return nil, Error(InvalidArgument, string(body))
+				},
+			},
+		},
+	})
+
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{text: "short", expected: "short"},
+		{text: "exactly 10", expected: "exactly 10"},
+		{text: "a very long error text", expected: "a very ..."},
+		{text: "123456äöü", expected: "123456..."},
+	}
+
+	for _, test := range tests {
+		resp := s.Execute(ctx, Request{Service: "my-service", Method: 1, Body: []byte(test.text)})
+		if resp.ErrorCode != InvalidArgument {
+			t.Fatalf("unexpected error code for %q: %v", test.text, resp.ErrorCode)
+		} else if resp.ErrorText != test.expected {
+			t.Fatalf("unexpected error text for %q: %q (expected %q)", test.text, resp.ErrorText, test.expected)
+		}
+	}
+
+	// Errors which are not returned by the handler are truncated as well.
+	resp := s.Execute(ctx, Request{Service: "unknown-service", Method: 1})
+	if resp.ErrorCode != NotFound || resp.ErrorText != "method ..." {
+		t.Fatalf("unexpected not-found response: %+v", resp)
+	}
+
+	var buf bytes.Buffer
+	if err := s.ServeMRPC(ctx, bytes.NewReader([]byte("garbage")), &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp = Response{}
+	if err := msgpack.Decode(&buf, &resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if resp.ErrorText != "decode ..." {
+		t.Fatalf("unexpected decode error text: %q", resp.ErrorText)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		text     string
+		n        int
+		expected string
+	}{
+		{text: "text", n: 0, expected: "text"},
+		{text: "text", n: 4, expected: "text"},
+		{text: "long text", n: 5, expected: "lo..."},
+		{text: "long text", n: 3, expected: "lon"},
+		{text: "long text", n: 1, expected: "l"},
+		{text: "äöü", n: 3, expected: "ä"},
+		{text: "äöü", n: 4, expected: "..."},
+		{text: "äöü", n: 5, expected: "ä..."},
+	}
+
+	for _, test := range tests {
+		if text := truncateText(test.text, test.n); text != test.expected {
+			t.Fatalf("unexpected text for %q and %d: %q (expected %q)", test.text, test.n, text, test.expected)
+		} else if test.n != 0 && len(text) > test.n {
+			t.Fatalf("text %q exceeds %d bytes", text, test.n)
+		}
+	}
+}
+
+func TestServerExecuteProtocolVersions(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t, WithProtocolVersions(1, 2))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return []byte("result"), nil
+				},
+			},
+		},
+	})
+
+	tests := []struct {
+		version uint8
+		code    ErrCode
+		text    string
+	}{
+		{version: 0, code: FailedPrecondition, text: "unsupported protocol version 0 (supported versions: 1 to 2)"},
+		{version: 1, code: OK},
+		{version: 2, code: OK},
+		{version: 3, code: FailedPrecondition, text: "unsupported protocol version 3 (supported versions: 1 to 2)"},
+	}
+
+	for _, test := range tests {
+		resp := s.Execute(ctx, Request{Service: "my-service", Method: 1, Headers: RequestHeaders{Version: test.version}})
+		if resp.ErrorCode != test.code {
+			t.Fatalf("unexpected error code for version %d: %v", test.version, resp.ErrorCode)
+		} else if resp.ErrorText != test.text {
+			t.Fatalf("unexpected error text for version %d: %q", test.version, resp.ErrorText)
+		}
+	}
+}
+
+func TestServerServeMRPCN(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t)
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return bytes.Repeat(body, 3), nil
+				},
+			},
+		},
+	})
+
+	var req bytes.Buffer
+	if err := msgpack.Encode(&req, &Request{Service: "my-service", Method: 1, Body: []byte("body")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reqSize := req.Len()
+
+	var resp bytes.Buffer
+	in, out, err := s.ServeMRPCN(ctx, &req, &resp)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var expected bytes.Buffer
+	if err := msgpack.Encode(&expected, &Response{Body: []byte("bodybodybody")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	switch {
+	case in != reqSize:
+		t.Fatalf("unexpected bytes in: %d (expected %d)", in, reqSize)
+	case out != resp.Len() || out != expected.Len():
+		t.Fatalf("unexpected bytes out: %d (expected %d)", out, expected.Len())
+	}
+}
+
+func TestServerServeMRPCTrailingData(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t)
+
+	handlerCalled := false
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					handlerCalled = true
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	var req bytes.Buffer
+	if err := msgpack.Encode(&req, &Request{Service: "my-service", Method: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string][]byte{
+		"garbage":          []byte("garbage"),
+		"single-byte":      {0xc0},
+		"repeated-request": req.Bytes(),
+	}
+	for name, trailer := range tests {
+		t.Run(name, func(t *testing.T) {
+			handlerCalled = false
+			data := append(append([]byte(nil), req.Bytes()...), trailer...)
+
+			var buf bytes.Buffer
+			if err := s.ServeMRPC(ctx, bytes.NewReader(data), &buf); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var resp Response
+			if err := msgpack.Decode(&buf, &resp); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			switch {
+			case handlerCalled:
+				t.Fatal("handler called for request with trailing data")
+			case resp.ErrorCode != InvalidArgument:
+				t.Fatalf("unexpected error code: %v", resp.ErrorCode)
+			case resp.ErrorText != "decode request: trailing data after request":
+				t.Fatalf("unexpected error text: %s", resp.ErrorText)
+			}
+		})
+	}
+}
+
+func TestServerServeMRPCOpenConnection(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t)
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return []byte("result"), nil
+				},
+			},
+		},
+	})
+
+	// The writer is never closed, like a persistent connection of a client.
+	pr, pw := io.Pipe()
+	go msgpack.Encode(pw, &Request{Service: "my-service", Method: 1})
+
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+	go func() { done <- s.ServeMRPC(ctx, pr, &buf) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request not served before the connection was closed")
+	}
+
+	var resp Response
+	if err := msgpack.Decode(&buf, &resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := ResponseError(resp); err != nil {
+		t.Fatalf("unexpected response error: %v", err)
+	} else if string(resp.Body) != "result" {
+		t.Fatalf("unexpected body: %q", resp.Body)
+	}
+}
+
+func TestServerServeMRPCMaxHeaderSize(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t, WithMaxHeaderSize(256))
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	tests := map[string]struct {
+		metadata map[string]string
+		code     ErrCode
+	}{
+		"small": {
+			metadata: map[string]string{"tenant": "acme"},
+		},
+		"oversized-metadata": {
+			metadata: map[string]string{"tenant": strings.Repeat("x", 256)},
+			code:     ResourceExhausted,
+		},
+		"many-entries": {
+			metadata: manyMetadataEntries(100),
+			code:     ResourceExhausted,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var req bytes.Buffer
+			err := msgpack.Encode(&req, &Request{
+				Service: "my-service",
+				Method:  1,
+				Headers: RequestHeaders{Metadata: test.metadata},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := s.ServeMRPC(ctx, &req, &buf); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var resp Response
+			if err := msgpack.Decode(&buf, &resp); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if resp.ErrorCode != test.code {
+				t.Fatalf("unexpected error code: %v (%s)", resp.ErrorCode, resp.ErrorText)
+			}
+		})
+	}
+}
+
+func TestServerServeMRPCMaxHeaderSizeForgedLength(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t, WithMaxHeaderSize(256))
+
+	// The metadata map claims a billion entries, but none follow.
+	var req bytes.Buffer
+	w := msgpack.NewWriter(&req)
+	w.WriteMapHeader(2)
+	w.WriteInt64(1)
+	w.WriteString("my-service")
+	w.WriteInt64(3)
+	w.WriteMapHeader(1)
+	w.WriteInt64(8)
+	w.WriteMapHeader(1 << 30)
+
+	var buf bytes.Buffer
+	if err := s.ServeMRPC(ctx, &req, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp Response
+	if err := msgpack.Decode(&buf, &resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if resp.ErrorCode != ResourceExhausted || resp.ErrorText != "decode request: request headers exceed the maximum of 256 bytes" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func manyMetadataEntries(n int) map[string]string {
+	m := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		m[strconv.Itoa(i)] = "v"
+	}
+	return m
+}
+
+func TestServerServeMRPCEncodingFallback(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t)
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return nil, errors.New("handler error")
+				},
+			},
+		},
+	})
+
+	var encoded []Response
+	s.encode = func(w io.Writer, resp *Response) error {
+		encoded = append(encoded, *resp)
+		if _, err := w.Write([]byte("partial")); err != nil {
+			return err
+		}
+		return errors.New("encoding error")
+	}
+
+	var req bytes.Buffer
+	if err := msgpack.Encode(&req, &Request{Service: "my-service", Method: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.ServeMRPC(ctx, &req, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp Response
+	if err := msgpack.Decode(&buf, &resp); err != nil {
+		t.Fatalf("undecodable response: %v", err)
+	}
+	switch {
+	case len(encoded) != 1 || encoded[0].ErrorText != "handler error":
+		t.Fatalf("unexpected encoded responses: %+v", encoded)
+	case resp.ErrorCode != Internal || resp.ErrorText != fallbackErrorText:
+		t.Fatalf("unexpected response: %+v", resp)
+	case buf.Len() != 0:
+		t.Fatalf("unexpected trailing data: %q", buf.Bytes())
+	}
+}
+
+func TestServerTransportInterceptor(t *testing.T) {
+	ctx := context.Background()
+
+	// Both interceptors flip all bits of the messages on the wire, so the
+	// outer one sees the encrypted and the inner one the plain messages.
+	flip := func(p []byte) []byte {
+		q := make([]byte, len(p))
+		for i := range p {
+			q[i] = ^p[i]
+		}
+		return q
+	}
+
+	var rawReq, rawResp []byte
+	s := newServer(t,
+		WithTransportInterceptor(func(ctx context.Context, raw []byte, next func([]byte) ([]byte, error)) ([]byte, error) {
+			resp, err := next(flip(raw))
+			if err != nil {
+				return nil, err
+			}
+			return flip(resp), nil
+		}),
+		WithTransportInterceptor(func(ctx context.Context, raw []byte, next func([]byte) ([]byte, error)) ([]byte, error) {
+			rawReq = raw
+			resp, err := next(raw)
+			rawResp = resp
+			return resp, err
+		}),
+	)
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return append([]byte("hello "), body...), nil
+				},
+			},
+		},
+	})
+
+	var req, expectedResp bytes.Buffer
+	if err := msgpack.Encode(&req, &Request{Service: "my-service", Method: 1, Body: []byte("world")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := msgpack.Encode(&expectedResp, &Response{Body: []byte("hello world")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp bytes.Buffer
+	if err := s.ServeMRPC(ctx, bytes.NewReader(flip(req.Bytes())), &resp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	switch {
+	case !bytes.Equal(rawReq, req.Bytes()):
+		t.Fatalf("unexpected raw request: %x", rawReq)
+	case !bytes.Equal(rawResp, expectedResp.Bytes()):
+		t.Fatalf("unexpected raw response: %x", rawResp)
+	case !bytes.Equal(resp.Bytes(), flip(expectedResp.Bytes())):
+		t.Fatalf("unexpected response: %x", resp.Bytes())
+	}
+
+	t.Run("error", func(t *testing.T) {
+		transportErr := errors.New("transport error")
+		s := newServer(t, WithTransportInterceptor(func(ctx context.Context, raw []byte, next func([]byte) ([]byte, error)) ([]byte, error) {
+			return nil, transportErr
+		}))
+
+		var resp bytes.Buffer
+		if err := s.ServeMRPC(ctx, bytes.NewReader(req.Bytes()), &resp); err != transportErr {
+			t.Fatalf("unexpected error: %v", err)
+		} else if resp.Len() != 0 {
+			t.Fatalf("unexpected response: %x", resp.Bytes())
+		}
+	})
+}
+
+func TestServerName(t *testing.T) {
+	ctx := context.Background()
+
+	for _, name := range []string{"", "instance-1"} {
+		var seen string
+		s := newServer(t,
+			WithServerName(name),
+			WithServerInterceptor(func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+				seen = ServerNameFromContext(ctx)
+				return h(ctx, call.Service, call.Body)
+			}),
+		)
+		s.Register(ServiceSpec{
+			Name:    "my-service",
+			Service: struct{}{},
+			Methods: []MethodSpec{
+				{
+					ID: 1,
+					Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+						return nil, nil
+					},
+				},
+			},
+		})
+
+		seen = "unset"
+		s.Execute(ctx, Request{Service: "my-service", Method: 1})
+		if seen != name {
+			t.Fatalf("unexpected server name: %q (expected %q)", seen, name)
+		}
+	}
+
+	if name := ServerNameFromContext(ctx); name != "" {
+		t.Fatalf("unexpected server name outside of a call: %q", name)
+	}
+}
+
+func TestServerInterceptorChain(t *testing.T) {
+	ctx := context.Background()
+
+	var executed []string
+	named := func(name string) NamedInterceptor {
+		return NamedInterceptor{
+			Name: name,
+			Interceptor: func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+				executed = append(executed, name)
+				return h(ctx, call.Service, call.Body)
+			},
+		}
+	}
+	middleware := func(h Handler) Handler {
+		return func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+			executed = append(executed, "")
+			return h(ctx, svc, body)
+		}
+	}
+
+	s := newServer(t,
+		WithNamedServerInterceptor(named("auth")),
+		WithMiddleware(middleware),
+		WithNamedServerInterceptor(named("metrics")),
+	)
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return nil, nil
+				},
+			},
+		},
+	})
+
+	chain := s.InterceptorChain("my-service", 1)
+	if expected := []string{"auth", "", "metrics"}; !reflect.DeepEqual(chain, expected) {
+		t.Fatalf("unexpected interceptor chain: %q", chain)
+	}
+
+	s.Execute(ctx, Request{Service: "my-service", Method: 1})
+	if !reflect.DeepEqual(executed, chain) {
+		t.Fatalf("unexpected execution order: %q (expected %q)", executed, chain)
+	}
+
+	if chain := s.InterceptorChain("my-service", 2); chain != nil {
+		t.Fatalf("unexpected interceptor chain for unknown method: %q", chain)
+	}
+}
+
+func TestServerServceMPRC(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t)
+
+	expectedResult := []byte("expected result")
+	handlerCalled := false
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 7,
+				Handler: func(ctx context.Context, svc interface{}, args []byte) ([]byte, error) {
+					handlerCalled = true
+					return expectedResult, nil
+				},
+			},
+		},
+	})
+
+	var req bytes.Buffer
+	err := msgpack.Encode(&req, &Request{
+		Service: "my-service",
+		Method:  7,
+		Headers: RequestHeaders{Timeout: uint64(time.Minute)},
+		Body:    []byte("request body"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var resp bytes.Buffer
+	err = s.ServeMRPC(ctx, &req, &resp)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !handlerCalled {
+		t.Fatal("handler not called")
+	}
+
+	var response Response
+	if err = msgpack.Decode(&resp, &response); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err = ResponseError(response); err != nil {
+		t.Fatalf("unexpected response error: %v", err)
+	} else if !bytes.Equal(response.Body, expectedResult) {
+		t.Fatalf("unexpected return: %+v", response.Body)
+	}
+}
+
+func BenchmarkServerExecute(b *testing.B) {
+	ctx := context.Background()
+
+	s, err := NewServer()
+	if err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return body, nil
+				},
+			},
+		},
+	})
+
+	req := Request{Service: "my-service", Method: 1, Body: []byte("body")}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Execute(ctx, req)
+	}
+}
+
+func BenchmarkServerServeMRPC(b *testing.B) {
+	ctx := context.Background()
+
+	s, err := NewServer()
+	if err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					return body, nil
+				},
+			},
+		},
+	})
+
+	var req bytes.Buffer
+	err = msgpack.Encode(&req, &Request{
+		Service: "my-service",
+		Method:  1,
+		Body:    bytes.Repeat([]byte("x"), 1024),
+	})
+	if err != nil {
+		b.Fatalf("unexpected error: %v", err)
+	}
+
+	r := bytes.NewReader(req.Bytes())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(req.Bytes())
+		if err := s.ServeMRPC(ctx, r, io.Discard); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func newServer(t *testing.T, opts ...ServerOption) *Server {
+	s, err := NewServer(opts...)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -0,0 +1,103 @@
+package mrpc
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// MethodStats holds the call statistics of a method (see WithMethodStats).
+// The latency percentiles are approximations with a relative error of
+// about 20 percent.
+type MethodStats struct {
+	Calls  uint64 // number of completed calls
+	Errors uint64 // number of failed calls
+	P50    time.Duration
+	P95    time.Duration
+	P99    time.Duration
+}
+
+// MethodStats returns the call statistics of the given method. The service
+// name is resolved as in Execute (see WithServiceResolver). Calls of all
+// versions and aliases of a method are combined. The function reports
+// false, if statistics are not enabled or the method is not registered.
+func (s *Server) MethodStats(service string, method int) (MethodStats, bool) {
+	if s.resolve != nil {
+		service = s.resolve(service)
+	}
+	m, has := s.methods[methodKey{service: service, id: method}]
+	if !has || m.stats == nil {
+		return MethodStats{}, false
+	}
+	return m.stats.snapshot(), true
+}
+
+const (
+	latencyBucketsPerDoubling = 4
+	latencyBuckets            = 32*latencyBucketsPerDoubling + 1
+	latencyMin                = time.Microsecond
+)
+
+// latencyHistogram is a histogram of call latencies with logarithmic
+// buckets. Bucket i counts the latencies up to latencyMin*2^(i/4), so the
+// buckets cover latencies from a microsecond to more than an hour. Larger
+// latencies are counted in the last bucket. The histogram is safe for
+// concurrent use and has a fixed size.
+type latencyHistogram struct {
+	errors  uint64
+	buckets [latencyBuckets]uint64
+}
+
+func (h *latencyHistogram) record(d time.Duration, failed bool) {
+	if failed {
+		atomic.AddUint64(&h.errors, 1)
+	}
+	atomic.AddUint64(&h.buckets[latencyBucket(d)], 1)
+}
+
+func (h *latencyHistogram) snapshot() MethodStats {
+	var (
+		counts [latencyBuckets]uint64
+		total  uint64
+	)
+	for i := range h.buckets {
+		counts[i] = atomic.LoadUint64(&h.buckets[i])
+		total += counts[i]
+	}
+
+	return MethodStats{
+		Calls:  total,
+		Errors: atomic.LoadUint64(&h.errors),
+		P50:    latencyPercentile(counts[:], total, 0.50),
+		P95:    latencyPercentile(counts[:], total, 0.95),
+		P99:    latencyPercentile(counts[:], total, 0.99),
+	}
+}
+
+func latencyBucket(d time.Duration) int {
+	if d <= latencyMin {
+		return 0
+	}
+	i := int(math.Ceil(latencyBucketsPerDoubling * math.Log2(float64(d)/float64(latencyMin))))
+	if i >= latencyBuckets {
+		return latencyBuckets - 1
+	}
+	return i
+}
+
+// latencyPercentile returns the upper bound of the bucket holding the
+// percentile p of all counted latencies.
+func latencyPercentile(counts []uint64, total uint64, p float64) time.Duration {
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(p * float64(total)))
+	var n uint64
+	for i, c := range counts {
+		if n += c; n >= rank {
+			return time.Duration(float64(latencyMin) * math.Exp2(float64(i)/latencyBucketsPerDoubling))
+		}
+	}
+	return 0
+}
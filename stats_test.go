@@ -0,0 +1,87 @@
+package mrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i)*time.Millisecond, i%10 == 0)
+	}
+
+	stats := h.snapshot()
+	tests := []struct {
+		name     string
+		value    time.Duration
+		expected time.Duration
+	}{
+		{"p50", stats.P50, 500 * time.Millisecond},
+		{"p95", stats.P95, 950 * time.Millisecond},
+		{"p99", stats.P99, 990 * time.Millisecond},
+	}
+	for _, test := range tests {
+		if test.value < test.expected || float64(test.value) > 1.2*float64(test.expected) {
+			t.Errorf("unexpected %s: %v (expected about %v)", test.name, test.value, test.expected)
+		}
+	}
+	if stats.Calls != 1000 || stats.Errors != 100 {
+		t.Fatalf("unexpected counts: %d calls, %d errors", stats.Calls, stats.Errors)
+	}
+
+	if b := latencyBucket(-time.Second); b != 0 {
+		t.Fatalf("unexpected bucket for negative latency: %d", b)
+	}
+	if b := latencyBucket(1000 * time.Hour); b != latencyBuckets-1 {
+		t.Fatalf("unexpected bucket for large latency: %d", b)
+	}
+}
+
+func TestServerMethodStats(t *testing.T) {
+	ctx := context.Background()
+	s := newServer(t, WithMethodStats())
+
+	handler := func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+		if len(body) == 0 {
+			return nil, Error(InvalidArgument, "empty body")
+		}
+		return body, nil
+	}
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{ID: 1, Version: 1, Handler: handler},
+			{ID: 1, Version: 2, Aliases: []int{10}, Handler: handler},
+		},
+	})
+
+	requests := []Request{
+		{Service: "my-service", Method: 1, Body: []byte("body")},
+		{Service: "my-service", Method: 1, Headers: RequestHeaders{MethodVersion: 2}},
+		{Service: "my-service", Method: 10, Body: []byte("body")},
+		{Service: "my-service", Method: 2},
+	}
+	for _, req := range requests {
+		s.Execute(ctx, req)
+	}
+
+	stats, ok := s.MethodStats("my-service", 1)
+	switch {
+	case !ok:
+		t.Fatal("missing method stats")
+	case stats.Calls != 3 || stats.Errors != 1:
+		t.Fatalf("unexpected counts: %d calls, %d errors", stats.Calls, stats.Errors)
+	case stats.P99 <= 0:
+		t.Fatalf("unexpected p99: %v", stats.P99)
+	}
+
+	if _, ok := s.MethodStats("my-service", 2); ok {
+		t.Fatal("unexpected stats of unknown method")
+	}
+	if _, ok := newServer(t).MethodStats("my-service", 1); ok {
+		t.Fatal("unexpected stats without WithMethodStats")
+	}
+}
@@ -0,0 +1,58 @@
+package mrpc
+
+import (
+	"context"
+	"sync"
+)
+
+// Values holds arbitrary values of a single method call. Interceptors can
+// use it to pass data to the following interceptors and the handler without
+// wrapping the context for each value. The values of a call are created
+// when the call is executed by a Server and discarded after the call has
+// completed. Values is safe for concurrent use.
+//
+// Interceptors access the values with CallInfo.Values, handlers with
+// CallValues. Keys should be of unexported types, as for context values.
+type Values struct {
+	mtx sync.Mutex
+	m   map[interface{}]interface{} // allocated on first use
+}
+
+// CallValues returns the values of the method call associated with ctx. If
+// ctx does not belong to a call executed by a Server, nil is returned.
+func CallValues(ctx context.Context) *Values {
+	if info, ok := ctx.Value(responseInfoKey{}).(*responseInfo); ok {
+		return &info.values
+	}
+	return nil
+}
+
+// Set sets the value for the given key. If v is nil, the value is
+// discarded.
+func (v *Values) Set(key, value interface{}) {
+	if v == nil {
+		return
+	}
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	if v.m == nil {
+		v.m = make(map[interface{}]interface{})
+	}
+	v.m[key] = value
+}
+
+// Get returns the value for the given key and reports whether the key was
+// set.
+func (v *Values) Get(key interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	value, has := v.m[key]
+	return value, has
+}
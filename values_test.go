@@ -0,0 +1,64 @@
+package mrpc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCallValues(t *testing.T) {
+	ctx := context.Background()
+
+	type userKey struct{}
+
+	var seen interface{}
+	s := newServer(t,
+		WithServerInterceptor(func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+			if string(call.Body) == "login" {
+				call.Values.Set(userKey{}, "alice")
+			}
+			return h(ctx, call.Service, call.Body)
+		}),
+		WithServerInterceptor(func(ctx context.Context, call CallInfo, h Handler) ([]byte, error) {
+			seen, _ = call.Values.Get(userKey{})
+			return h(ctx, call.Service, call.Body)
+		}),
+	)
+	s.Register(ServiceSpec{
+		Name:    "my-service",
+		Service: struct{}{},
+		Methods: []MethodSpec{
+			{
+				ID: 1,
+				Handler: func(ctx context.Context, svc interface{}, body []byte) ([]byte, error) {
+					user, _ := CallValues(ctx).Get(userKey{})
+					s, _ := user.(string)
+					return []byte(s), nil
+				},
+			},
+		},
+	})
+
+	resp := s.Execute(ctx, Request{Service: "my-service", Method: 1, Body: []byte("login")})
+	switch {
+	case ResponseError(resp) != nil:
+		t.Fatalf("unexpected error: %v", ResponseError(resp))
+	case seen != "alice":
+		t.Fatalf("unexpected value in interceptor: %v", seen)
+	case string(resp.Body) != "alice":
+		t.Fatalf("unexpected value in handler: %s", resp.Body)
+	}
+
+	// Each call has its own values.
+	resp = s.Execute(ctx, Request{Service: "my-service", Method: 1})
+	if seen != nil || len(resp.Body) != 0 {
+		t.Fatalf("unexpected value of previous call: %v", seen)
+	}
+}
+
+func TestCallValuesWithoutCall(t *testing.T) {
+	values := CallValues(context.Background())
+	values.Set("key", "value")
+	if _, has := values.Get("key"); has {
+		t.Fatal("unexpected value without call")
+	}
+}
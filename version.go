@@ -0,0 +1,19 @@
+package mrpc
+
+// ProtocolVersion is the version of the mrpc protocol implemented by this
+// package. Clients send it with each request (see RequestHeaders.Version),
+// so that servers can reject incompatible clients (see
+// WithProtocolVersions). Requests of clients which predate the protocol
+// versioning carry version 0.
+const ProtocolVersion uint8 = 1
+
+type versionRange struct {
+	min, max uint8
+}
+
+func (r *versionRange) check(version uint8) error {
+	if r == nil || (r.min <= version && version <= r.max) {
+		return nil
+	}
+	return Errorf(FailedPrecondition, "unsupported protocol version %d (supported versions: %d to %d)", version, r.min, r.max)
+}